@@ -2,7 +2,6 @@ package chess
 
 import (
 	"fmt"
-	"strconv"
 	"strings"
 )
 
@@ -10,7 +9,17 @@ import (
 const BOARD_SIZE int = 8
 
 // Board a fully inflated board to be worked on
-type Board [BOARD_SIZE][BOARD_SIZE]*cell
+type Board struct {
+	cells [BOARD_SIZE][BOARD_SIZE]*cell
+	// score and coverage are kept up to date as pieces are set and the support graph is settled, since
+	// they're needed far more often than they change
+	score    int
+	coverage int
+}
+
+// debugCacheChecks makes Score and GetCoverageLevel check their cached values against a full count of the
+// board.  This is far too slow to leave on, but is enabled by the tests
+var debugCacheChecks = false
 
 // cell a cell for the working board
 type cell struct {
@@ -34,19 +43,46 @@ func (ps pointSet) has(p point) bool { _, ok := ps[p]; return ok }
 
 // MinimalBoard the representation used to store boards that are not actively being worked on
 type MinimalBoard struct {
-	board     [BOARD_SIZE * BOARD_SIZE]Piece
+	board     BoardKey
 	Heuristic float32
 	IsSolved  bool
 	Score     int
 	Coverage  int
 }
 
+// BoardKey the pieces of a board, without any of the derived information kept in MinimalBoard
+type BoardKey [BOARD_SIZE * BOARD_SIZE]Piece
+
+// Key returns the pieces of the board, indexed by x * BOARD_SIZE + y
+func (m MinimalBoard) Key() BoardKey {
+	return m.board
+}
+
 // MinimalBoardSet a map wrapper for tracking sets of boards
 type MinimalBoardSet map[MinimalBoard]struct{}
 
 func (m MinimalBoardSet) Put(board MinimalBoard)           { m[board] = SENTINEL }
 func (m MinimalBoardSet) Contains(board MinimalBoard) bool { _, ok := m[board]; return ok }
 
+// BoardKeySet a map wrapper for tracking sets of boards by their pieces alone, so a board is the same member
+// whatever heuristic or score it's carrying
+type BoardKeySet map[BoardKey]struct{}
+
+func (s BoardKeySet) Put(board MinimalBoard)           { s[board.Key()] = SENTINEL }
+func (s BoardKeySet) Contains(board MinimalBoard) bool { _, ok := s[board.Key()]; return ok }
+func (s BoardKeySet) Remove(board MinimalBoard)        { delete(s, board.Key()) }
+
+// Less orders boards by their pieces alone, so that boards can be sorted stably regardless of how they
+// were found
+func (m MinimalBoard) Less(other MinimalBoard) bool {
+	for i, piece := range m.board {
+		if piece != other.board[i] {
+			return piece < other.board[i]
+		}
+	}
+	return false
+}
+
 // copy Does *NOT* copy support
 func (c *cell) copy() *cell {
 	result := &cell{piece: c.piece}
@@ -108,7 +144,7 @@ func (p point) y() int8 {
 
 // getCell gets a cell from the board using a point
 func (b *Board) getCell(p point) *cell {
-	return b[p.x()][p.y()]
+	return b.cells[p.x()][p.y()]
 }
 
 // isEmpty reports if a cell contains a piece
@@ -116,67 +152,78 @@ func (b *Board) isEmpty(p point) bool {
 	return b.getCell(p).piece == NONE
 }
 
+// coverageScratch holds the coverage of every piece for getAllCoverage, indexed by piece.  The sets are
+// cleared and refilled on every call rather than reallocated, so the results are only valid until the next call
+type coverageScratch [QUEEN + 1]pointSet
+
+func newCoverageScratch() *coverageScratch {
+	return &coverageScratch{
+		PAWN:   make(pointSet, 2),
+		KNIGHT: make(pointSet, 8),
+		BISHOP: make(pointSet, BOARD_SIZE*2),
+		ROOK:   make(pointSet, BOARD_SIZE*2),
+		QUEEN:  make(pointSet, BOARD_SIZE*4),
+	}
+}
+
 // getAllCoverage this reports contextual coverage that each piece would provide on a
 // given cell of a given board.  This takes into account board boundaries (knight and
-// pawn) and blocked cells (rook, bishop, queen)
-func (b *Board) getAllCoverage(p point) (map[Piece]pointSet, error) {
-	result := make(map[Piece]pointSet, 5)
-	coverage, err := getCoverage(b, p, PAWN)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get pawn coverage: %w", err)
-	}
-	result[PAWN] = coverage
-	coverage, err = getCoverage(b, p, KNIGHT)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get knight coverage: %w", err)
+// pawn) and blocked cells (rook, bishop, queen).  A queen covers exactly what a rook and
+// a bishop would, so its coverage is built from theirs instead of walking the rays again
+func (b *Board) getAllCoverage(p point, scratch *coverageScratch) {
+	for _, coverage := range scratch[PAWN:] {
+		clear(coverage)
 	}
-	result[KNIGHT] = coverage
-	coverage, err = getCoverage(b, p, ROOK)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get rook coverage: %w", err)
+	addPawnCoverage(p, scratch[PAWN])
+	addKnightCoverage(p, scratch[KNIGHT])
+	addRookCoverage(b, p, scratch[ROOK])
+	addBishopCoverage(b, p, scratch[BISHOP])
+	for coveredPoint := range scratch[ROOK] {
+		scratch[QUEEN].put(coveredPoint)
 	}
-	result[ROOK] = coverage
-	coverage, err = getCoverage(b, p, BISHOP)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get bishop coverage: %w", err)
-	}
-	result[BISHOP] = coverage
-	coverage, err = getCoverage(b, p, QUEEN)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get queen coverage: %w", err)
+	for coveredPoint := range scratch[BISHOP] {
+		scratch[QUEEN].put(coveredPoint)
 	}
-	result[QUEEN] = coverage
-
-	return result, nil
 }
 
-// getMinimalBoard returns a deflated copy of a Board
-func (b *Board) getMinimalBoard(heuristic func(board *Board) (float32, error)) (MinimalBoard, error) {
-	heuristicScore, err := heuristic(b)
-	if err != nil {
-		return MinimalBoard{}, fmt.Errorf("failed to calculate heuristic while minimizing: %w", err)
-	}
+// getMinimalBoard returns a deflated copy of a Board, valued at heuristicScore
+func (b *Board) getMinimalBoard(heuristicScore float32) (MinimalBoard, error) {
 	score, err := b.Score()
 	if err != nil {
 		return MinimalBoard{}, fmt.Errorf("failed to score board while minimizing: %w", err)
 	}
-	result := MinimalBoard{
+	return MinimalBoard{
+		board:     b.key(),
 		Heuristic: heuristicScore,
 		IsSolved:  b.GetCoverageLevel() == BOARD_SIZE*BOARD_SIZE,
 		Score:     score,
 		Coverage:  b.GetCoverageLevel(),
-	}
-	for x, row := range b {
+	}, nil
+}
+
+// key returns the pieces of the board, laid out the same way as MinimalBoard.Key
+func (b *Board) key() (result BoardKey) {
+	for x, row := range b.cells {
 		for y, c := range row {
-			result.board[(x*BOARD_SIZE)+y] = c.piece
+			result[(x*BOARD_SIZE)+y] = c.piece
 		}
 	}
-	return result, nil
+	return
 }
 
 // GetCoverageLevel reports how many of the cells on the board are covered
-func (b *Board) GetCoverageLevel() (result int) {
-	for _, row := range b {
+func (b *Board) GetCoverageLevel() int {
+	if debugCacheChecks {
+		if counted := b.countCoverage(); counted != b.coverage {
+			panic(fmt.Sprintf("cached coverage %d does not match counted coverage %d", b.coverage, counted))
+		}
+	}
+	return b.coverage
+}
+
+// countCoverage counts how many of the cells on the board are covered
+func (b *Board) countCoverage() (result int) {
+	for _, row := range b.cells {
 		for _, currCell := range row {
 			if len(currCell.supportedBy) > 0 {
 				result++
@@ -188,8 +235,22 @@ func (b *Board) GetCoverageLevel() (result int) {
 
 // Score reports the piece based score for a board
 func (b *Board) Score() (int, error) {
+	if debugCacheChecks {
+		counted, err := b.countScore()
+		if err != nil {
+			return 0, err
+		}
+		if counted != b.score {
+			panic(fmt.Sprintf("cached score %d does not match counted score %d", b.score, counted))
+		}
+	}
+	return b.score, nil
+}
+
+// countScore adds up the piece based score for a board
+func (b *Board) countScore() (int, error) {
 	result := 0
-	for _, row := range b {
+	for _, row := range b.cells {
 		for _, currCell := range row {
 			if currCell.piece != NONE {
 				score, err := GetScore(currCell.piece)
@@ -203,12 +264,44 @@ func (b *Board) Score() (int, error) {
 	return result, nil
 }
 
-// copy Does *NOT* copy support
+// Score adds up the piece based score of a board, without rebuilding it
+func (k BoardKey) Score() (int, error) {
+	result := 0
+	for _, piece := range k {
+		if piece != NONE {
+			score, err := GetScore(piece)
+			if err != nil {
+				return result, fmt.Errorf("failed to score board: %w", err)
+			}
+			result += score
+		}
+	}
+	return result, nil
+}
+
+// setPiece places a piece on a cell, or clears it with NONE, keeping the score up to date.  Like any other
+// change to the pieces, the support graph must be settled again afterwards
+func (b *Board) setPiece(p point, piece Piece) {
+	currCell := b.getCell(p)
+	b.score += pieceScore(piece) - pieceScore(currCell.piece)
+	currCell.piece = piece
+}
+
+// pieceScore is GetScore, but with empty cells scoring nothing
+func pieceScore(piece Piece) int {
+	if piece == NONE {
+		return 0
+	}
+	score, _ := GetScore(piece)
+	return score
+}
+
+// copy Does *NOT* copy support, so the copy has no coverage until it is settled
 func (b *Board) copy() *Board {
-	newBoard := &Board{}
-	for x, row := range b {
+	newBoard := &Board{score: b.score}
+	for x, row := range b.cells {
 		for y, currCell := range row {
-			newBoard[x][y] = currCell.copy()
+			newBoard.cells[x][y] = currCell.copy()
 		}
 	}
 	return newBoard
@@ -218,13 +311,14 @@ func (b *Board) copy() *Board {
 // most expensive calls in this algorithm, and overall performance could be significantly
 // improved if this function was improved.
 func (b *Board) settleSupportGraph() error {
-	for _, row := range b {
+	for _, row := range b.cells {
 		for _, currCell := range row {
 			currCell.clearSupport()
 		}
 	}
+	b.coverage = 0
 	// find all the pieces on the board
-	for x, row := range b {
+	for x, row := range b.cells {
 		for y, currCell := range row {
 			// when a piece is found, calculate its coverage and mark the board
 			if currCell.piece != NONE {
@@ -235,7 +329,11 @@ func (b *Board) settleSupportGraph() error {
 				}
 				currCell.supports = coverage
 				for coveredPoint := range coverage {
-					b.getCell(coveredPoint).addSupport(currPoint)
+					coveredCell := b.getCell(coveredPoint)
+					if len(coveredCell.supportedBy) == 0 {
+						b.coverage++
+					}
+					coveredCell.addSupport(currPoint)
 				}
 			}
 		}
@@ -247,7 +345,8 @@ func (b *Board) settleSupportGraph() error {
 func (m MinimalBoard) RebuildBoard() (*Board, error) {
 	board := &Board{}
 	for i, piece := range m.board {
-		board[i/BOARD_SIZE][i%BOARD_SIZE] = &cell{piece: piece}
+		board.cells[i/BOARD_SIZE][i%BOARD_SIZE] = &cell{}
+		board.setPiece(point(i), piece)
 	}
 	err := board.settleSupportGraph()
 	if err != nil {
@@ -256,27 +355,47 @@ func (m MinimalBoard) RebuildBoard() (*Board, error) {
 	return board, nil
 }
 
+// Rebuild recreates the MinimalBoard with these pieces.  Everything but the heuristic is recalculated, since
+// that depends on how the board is being searched
+func (k BoardKey) Rebuild() (MinimalBoard, error) {
+	board, err := MinimalBoard{board: k}.RebuildBoard()
+	if err != nil {
+		return MinimalBoard{}, err
+	}
+	return board.getMinimalBoard(0)
+}
+
 func (m MinimalBoard) String() string {
 	result := strings.Builder{}
 	for x := 0; x < BOARD_SIZE; x++ {
 		for y := 0; y < BOARD_SIZE; y++ {
-			result.WriteRune(m.board[(y*BOARD_SIZE)+x].GetRune())
+			result.WriteRune(m.board[newPointUnsafe(x, y)].GetRune())
 		}
 		result.WriteString("\n")
 	}
 	result.WriteString(
-		fmt.Sprintf("Score: %d\tHeuristic: %f\tSolved: %t\tCoverage%d",
+		fmt.Sprintf("Score: %d\tHeuristic: %f\tSolved: %t\tCoverage: %d",
 			m.Score, m.Heuristic, m.IsSolved, m.Coverage))
 	return result.String()
 }
 
 // ProposeBoards is used to calculate all the potential boards that could be reached from a given board.  It
 // is where the algorithm spends most of its time, and any additional early pruning techniques would benefit
-// it greatly
-func (b *Board) ProposeBoards(heuristic func(board *Board) (float32, error)) (MinimalBoardSet, error) {
-	result := MinimalBoardSet{}
+// it greatly.  Proposals that would score over bound are skipped before doing any of the expensive work,
+// unless reducing them might bring them back within the bound.  The heuristic values every distinct proposal
+// in a single call, returning the values in the same order, so heuristics with a cost per call, like a round
+// trip to a remote service, only pay it once per expansion
+func (b *Board) ProposeBoards(heuristic func(boards []*Board) ([]float32, error), bound int) (MinimalBoardSet, error) {
+	var proposals []*Board
+	proposed := map[BoardKey]struct{}{}
+	score, err := b.Score()
+	if err != nil {
+		return nil, fmt.Errorf("failed to score board while proposing: %w", err)
+	}
+	pieces := b.getPlacedPieces()
+	scratch := newCoverageScratch()
 	// check each cell
-	for x, row := range b {
+	for x, row := range b.cells {
 		for y, currCell := range row {
 			// if the cell is occupied, skip it
 			if currCell.piece != NONE {
@@ -284,12 +403,10 @@ func (b *Board) ProposeBoards(heuristic func(board *Board) (float32, error)) (Mi
 			}
 			// calculate coverages for each possible piece at this point
 			currCellPoint, _ := newPoint(x, y)
-			coverages, err := b.getAllCoverage(currCellPoint)
-			if err != nil {
-				return nil, fmt.Errorf("failed to get coverages: %w", err)
-			}
+			b.getAllCoverage(currCellPoint, scratch)
 			// check each pieces coverages
-			for piece, coverage := range coverages {
+			for piece := PAWN; piece <= QUEEN; piece++ {
+				coverage := scratch[piece]
 				var coveredNew bool
 				// check if the coverage would cover any new cells
 				for currThreatenedPoint := range coverage {
@@ -298,42 +415,117 @@ func (b *Board) ProposeBoards(heuristic func(board *Board) (float32, error)) (Mi
 						break
 					}
 				}
-				// if the piece would change the state of the board, create a new
-				// board with that modification
-				if coveredNew {
-					// NB: all work here is done on the *copy*, not modifying the original board
-					newBoard := b.copy()
-					newBoard[currCellPoint.x()][currCellPoint.y()].piece = piece
-					err = newBoard.settleSupportGraph()
-					if err != nil {
-						return nil, fmt.Errorf("failed to settle cloned board: %w", err)
-					}
-					// once we have the new board, calculate its reductions
-					reducedBoards, err := newBoard.reduce()
-					if err != nil {
-						return nil, fmt.Errorf("failed to reduce cloned board: %w", err)
-					}
-					for _, reducedBoard := range reducedBoards {
-						minimalBoard, err := reducedBoard.getMinimalBoard(heuristic)
-						if err != nil {
-							return nil, fmt.Errorf("failed to minimize cloned board: %w", err)
-						}
-						// and finally add the reduced boards to the possible next boards
-						result.Put(minimalBoard)
+				// if the piece wouldn't change the state of the board, there's nothing to propose
+				if !coveredNew {
+					continue
+				}
+				// if the piece would push the board over the bound, and no other piece could be reduced away
+				// to make up for it, there's no point building the board just to throw it away
+				pieceScore, err := GetScore(piece)
+				if err != nil {
+					return nil, fmt.Errorf("failed to score proposed piece: %w", err)
+				}
+				if score+pieceScore > bound && !mayReduce(pieces, currCellPoint, coverage) {
+					continue
+				}
+				// NB: all work here is done on the *copy*, not modifying the original board
+				newBoard := b.copy()
+				newBoard.setPiece(currCellPoint, piece)
+				err = newBoard.settleSupportGraph()
+				if err != nil {
+					return nil, fmt.Errorf("failed to settle cloned board: %w", err)
+				}
+				// once we have the new board, calculate its reductions
+				reducedBoards, err := newBoard.reduce()
+				if err != nil {
+					return nil, fmt.Errorf("failed to reduce cloned board: %w", err)
+				}
+				// different placements often reduce to the same board, which only needs valuing once
+				for _, reducedBoard := range reducedBoards {
+					key := reducedBoard.key()
+					if _, ok := proposed[key]; !ok {
+						proposed[key] = SENTINEL
+						proposals = append(proposals, reducedBoard)
 					}
 				}
 			}
 		}
 	}
+	if len(proposals) == 0 {
+		return MinimalBoardSet{}, nil
+	}
+	heuristicScores, err := heuristic(proposals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate heuristic while proposing: %w", err)
+	}
+	if len(heuristicScores) != len(proposals) {
+		return nil, fmt.Errorf("heuristic returned %d values for %d boards", len(heuristicScores), len(proposals))
+	}
+	// and finally add the reduced boards to the possible next boards
+	result := make(MinimalBoardSet, len(proposals))
+	for i, proposal := range proposals {
+		minimalBoard, err := proposal.getMinimalBoard(heuristicScores[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to minimize cloned board: %w", err)
+		}
+		result.Put(minimalBoard)
+	}
 	return result, nil
 }
 
+// placedPiece a piece on the board, what it covers, and the cells that no other piece covers
+type placedPiece struct {
+	piece    Piece
+	supports pointSet
+	unique   []point
+}
+
+// getPlacedPieces finds every piece on the board along with the cells only it covers
+func (b *Board) getPlacedPieces() []placedPiece {
+	var result []placedPiece
+	for _, row := range b.cells {
+		for _, currCell := range row {
+			if currCell.piece == NONE {
+				continue
+			}
+			placed := placedPiece{piece: currCell.piece, supports: currCell.supports}
+			for supportedPoint := range currCell.supports {
+				if len(b.getCell(supportedPoint).supportedBy) == 1 {
+					placed.unique = append(placed.unique, supportedPoint)
+				}
+			}
+			result = append(result, placed)
+		}
+	}
+	return result
+}
+
+// mayReduce reports if adding a piece at p with the given coverage might let reduce remove any of the
+// existing pieces.  A piece can only become removable if everything only it covered is now also covered by
+// the new piece, or if the new piece blocks one of its rays and changes what it covers.  This can have false
+// positives, but never false negatives, so it's safe to use for pruning
+func mayReduce(pieces []placedPiece, p point, coverage pointSet) bool {
+pieceLoop:
+	for _, placed := range pieces {
+		if placed.piece != PAWN && placed.piece != KNIGHT && placed.supports.has(p) {
+			return true
+		}
+		for _, uniquePoint := range placed.unique {
+			if !coverage.has(uniquePoint) {
+				continue pieceLoop
+			}
+		}
+		return true
+	}
+	return false
+}
+
 // reduce is used to see if a board has any pieces that can be removed without effecting the coverage.  If
 // there are any, it will return all possible permutations that don't affect the coverage.
 func (b *Board) reduce() ([]*Board, error) {
 	result := []*Board{}
 	// check each cell to see if it's contributing
-	for x, row := range b {
+	for x, row := range b.cells {
 	cellLoop:
 		for y, currCell := range row {
 			if currCell.piece == NONE {
@@ -349,7 +541,7 @@ func (b *Board) reduce() ([]*Board, error) {
 			// if a piece is found to be not contributing, copy the board, remove the piece,
 			// and see if the new board reduces further
 			newBoard := b.copy()
-			newBoard.getCell(newPointUnsafe(x, y)).piece = NONE
+			newBoard.setPiece(newPointUnsafe(x, y), NONE)
 			err := newBoard.settleSupportGraph()
 			if err != nil {
 				return nil, fmt.Errorf("failed to settle board while reducing: %w", err)
@@ -371,30 +563,12 @@ func (b *Board) reduce() ([]*Board, error) {
 	return result, nil
 }
 
-// String this draws the board in negative x, y space
-func (b *Board) String(heuristic func(board *Board) (float32, error)) string {
-	result := strings.Builder{}
-	for _, row := range b {
-		for _, currCell := range row {
-			if currCell.piece != NONE {
-				result.WriteRune(currCell.piece.GetRune())
-			} else {
-				result.WriteString(strconv.Itoa(len(currCell.supportedBy)))
-			}
-		}
-		result.WriteString("\n")
-	}
-	score, err := b.Score()
-	if err != nil {
-		return fmt.Sprintf("failed to calculate score while buildind string: %v", err)
-	}
-	heuristicScore, err := heuristic(b)
-	if err != nil {
-		return fmt.Sprintf("failed to calculate heuristic while buildind string: %v", err)
-	}
-	solved := b.GetCoverageLevel() == BOARD_SIZE*BOARD_SIZE
-	coverage := b.GetCoverageLevel()
-	result.WriteString(fmt.Sprintf("Score: %d\tHeuristic: %f\tSolved: %t\tCoverage: %d",
-		score, heuristicScore, solved, coverage))
-	return result.String()
+// String this draws the board in negative x, y space, along with its cached score and coverage
+func (b *Board) String() string {
+	return b.Render(RenderOptions{})
+}
+
+// Describe is String, with the board's value under the given heuristic included
+func (b *Board) Describe(heuristic func(board *Board) (float32, error)) string {
+	return b.Render(RenderOptions{Heuristic: heuristic})
 }
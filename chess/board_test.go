@@ -1,16 +1,26 @@
 package chess
 
-import "testing"
+import (
+	"fmt"
+	"maps"
+	"math"
+	"strings"
+	"testing"
+)
 
 // TODO: add more testing.  This is just the testing that came up during debugging
 
+func init() {
+	debugCacheChecks = true
+}
+
 func TestBoard_settleSupportGraph(t *testing.T) {
 	board, err := MinimalBoard{}.RebuildBoard()
 	if err != nil {
 		t.Logf("unexpected error rebuilding board")
 		t.FailNow()
 	}
-	for x, row := range board {
+	for x, row := range board.cells {
 		for y, currCell := range row {
 			if len(currCell.supportedBy) > 0 {
 				t.Logf("cell is unexpectedly supported: %d, %d", x, y)
@@ -18,7 +28,7 @@ func TestBoard_settleSupportGraph(t *testing.T) {
 			}
 		}
 	}
-	board.getCell(newPointUnsafe(0, 0)).piece = QUEEN
+	board.setPiece(newPointUnsafe(0, 0), QUEEN)
 	if board.getCell(newPointUnsafe(0, 0)).piece != QUEEN {
 		t.Logf("queen failed to stay set")
 		t.FailNow()
@@ -131,3 +141,136 @@ func getBasicCompleteKnightBoard() (MinimalBoard, int, string) {
 	score, _ := GetScore(KNIGHT)
 	return board, score * BOARD_SIZE * BOARD_SIZE, "knight board"
 }
+
+// the score pre-filter in ProposeBoards must never drop a board that would have ended up within the bound
+func TestBoard_ProposeBoardsBound(t *testing.T) {
+	heuristic := func(boards []*Board) ([]float32, error) { return make([]float32, len(boards)), nil }
+	unbounded := func(board *Board) MinimalBoardSet {
+		proposed, err := board.ProposeBoards(heuristic, math.MaxInt)
+		if err != nil {
+			t.Fatalf("failed to propose boards: %v", err)
+		}
+		return proposed
+	}
+	root, err := MinimalBoard{}.RebuildBoard()
+	if err != nil {
+		t.Fatalf("failed to rebuild board: %v", err)
+	}
+	// check the root, and a sample of boards two placements deep
+	boards := []*Board{root}
+	for firstPlacement := range unbounded(root) {
+		if len(boards) > BOARD_SIZE {
+			break
+		}
+		board, err := firstPlacement.RebuildBoard()
+		if err != nil {
+			t.Fatalf("failed to rebuild board: %v", err)
+		}
+		for secondPlacement := range unbounded(board) {
+			board, err := secondPlacement.RebuildBoard()
+			if err != nil {
+				t.Fatalf("failed to rebuild board: %v", err)
+			}
+			boards = append(boards, board)
+			break
+		}
+	}
+	for _, board := range boards {
+		expected := unbounded(board)
+		for _, bound := range []int{0, 5, 10, 15} {
+			proposed, err := board.ProposeBoards(heuristic, bound)
+			if err != nil {
+				t.Fatalf("failed to propose boards: %v", err)
+			}
+			for expectedBoard := range expected {
+				if expectedBoard.Score <= bound && !proposed.Contains(expectedBoard) {
+					t.Errorf("bound %d dropped a board within the bound:\n%s", bound, expectedBoard)
+				}
+			}
+		}
+	}
+}
+
+func TestBoard_getAllCoverage(t *testing.T) {
+	minimalBoard, _, _ := getBasicCompletePawnBoard()
+	// knock a few holes in the board, so the rays have something to do
+	for i := BOARD_SIZE; i < BOARD_SIZE*BOARD_SIZE; i += 3 {
+		minimalBoard.board[i] = NONE
+	}
+	board, err := minimalBoard.RebuildBoard()
+	if err != nil {
+		t.Fatalf("failed to rebuild board: %v", err)
+	}
+	scratch := newCoverageScratch()
+	for x := 0; x < BOARD_SIZE; x++ {
+		for y := 0; y < BOARD_SIZE; y++ {
+			p := newPointUnsafe(x, y)
+			board.getAllCoverage(p, scratch)
+			for piece := PAWN; piece <= QUEEN; piece++ {
+				expected, err := getCoverage(board, p, piece)
+				if err != nil {
+					t.Fatalf("failed to get coverage: %v", err)
+				}
+				if !maps.Equal(expected, scratch[piece]) {
+					t.Errorf("unexpected coverage for %c at %d,%d.  wanted %v but got %v",
+						piece.GetRune(), x, y, expected, scratch[piece])
+				}
+			}
+		}
+	}
+}
+
+func TestBoard_String(t *testing.T) {
+	minimalBoard, expectedScore, _ := getBasicCompletePawnBoard()
+	board, err := minimalBoard.RebuildBoard()
+	if err != nil {
+		t.Fatalf("failed to rebuild board: %v", err)
+	}
+	var stringer fmt.Stringer = board
+	summary := fmt.Sprintf("Score: %d\tSolved: true\tCoverage: %d", expectedScore, BOARD_SIZE*BOARD_SIZE)
+	if !strings.HasSuffix(stringer.String(), summary) {
+		t.Errorf("unexpected string.  wanted suffix %q but got %q", summary, stringer.String())
+	}
+	description := board.Describe(func(*Board) (float32, error) { return 1.5, nil })
+	if !strings.Contains(description, "Heuristic: 1.500000") {
+		t.Errorf("description is missing the heuristic: %q", description)
+	}
+	if strings.Count(description, "\n") != BOARD_SIZE {
+		t.Errorf("description should draw %d rows: %q", BOARD_SIZE, description)
+	}
+}
+
+func TestMinimalBoard_String(t *testing.T) {
+	// a piece off the diagonal, so a transposed drawing would put it in the wrong place
+	minimalBoard := MinimalBoard{}
+	minimalBoard.board[newPointUnsafe(0, 1)] = KNIGHT
+	board, err := minimalBoard.RebuildBoard()
+	if err != nil {
+		t.Fatalf("failed to rebuild board: %v", err)
+	}
+	rendered := board.Render(RenderOptions{Empty: EMPTY_NONE})
+	grid := rendered[:strings.LastIndex(rendered, "\n")]
+	if !strings.HasPrefix(minimalBoard.String(), grid+"\n") {
+		t.Errorf("expected the same drawing as the rebuilt board.  wanted\n%s\nbut got\n%s", grid, minimalBoard.String())
+	}
+	if !strings.HasSuffix(minimalBoard.String(), "Coverage: 0") {
+		t.Errorf("unexpected summary line: %q", minimalBoard.String())
+	}
+}
+
+func TestBoardKey(t *testing.T) {
+	minimalBoard, expectedScore, _ := getBasicCompletePawnBoard()
+	rebuilt, err := minimalBoard.Key().Rebuild()
+	if err != nil {
+		t.Fatalf("failed to rebuild board: %v", err)
+	}
+	expected := MinimalBoard{board: minimalBoard.board, IsSolved: true, Score: expectedScore,
+		Coverage: BOARD_SIZE * BOARD_SIZE}
+	if rebuilt != expected {
+		t.Errorf("unexpected board.  wanted\n%v\nbut got\n%v", expected, rebuilt)
+	}
+	score, err := minimalBoard.Key().Score()
+	if err != nil || score != expectedScore {
+		t.Errorf("unexpected score.  wanted %d but got %d (%v)", expectedScore, score, err)
+	}
+}
@@ -0,0 +1,113 @@
+package chess
+
+import "fmt"
+
+// FEATURE_VERSION identifies the layout of FeatureVector.  Any change to the set, order, or meaning of the
+// features *must* bump this, so that models trained against an older layout can be rejected instead of
+// silently producing garbage
+const FEATURE_VERSION = 1
+
+// indexes of each feature in a FeatureVector
+const (
+	// FEATURE_BOARD_SIZE the width of the board.  Constant within a build, but lets datasets from different
+	// builds be mixed
+	FEATURE_BOARD_SIZE int = iota
+	// FEATURE_SCORE the piece based score of the board
+	FEATURE_SCORE
+	// FEATURE_COVERAGE the number of cells supported by at least one piece
+	FEATURE_COVERAGE
+	// FEATURE_UNCOVERED the number of cells not supported by any piece
+	FEATURE_UNCOVERED
+	// FEATURE_COVERAGE_PER_POINT coverage divided by score, or 0 for an empty board
+	FEATURE_COVERAGE_PER_POINT
+	// FEATURE_PAWNS through FEATURE_QUEENS are the number of each piece on the board
+	FEATURE_PAWNS
+	FEATURE_KNIGHTS
+	FEATURE_BISHOPS
+	FEATURE_ROOKS
+	FEATURE_QUEENS
+	// FEATURE_SUPPORT_EDGES the total number of (piece, covered cell) pairs.  Anything above coverage is overlap
+	FEATURE_SUPPORT_EDGES
+	// FEATURE_SINGLY_COVERED the number of cells supported by exactly one piece
+	FEATURE_SINGLY_COVERED
+	// FEATURE_SUPPORTED_PIECES the number of pieces that sit on a covered cell
+	FEATURE_SUPPORTED_PIECES
+	// FEATURE_COUNT the length of a FeatureVector.  Must stay last
+	FEATURE_COUNT
+)
+
+// FeatureNames human readable names for each feature, indexed the same as FeatureVector
+var FeatureNames = [FEATURE_COUNT]string{
+	FEATURE_BOARD_SIZE:         "board_size",
+	FEATURE_SCORE:              "score",
+	FEATURE_COVERAGE:           "coverage",
+	FEATURE_UNCOVERED:          "uncovered",
+	FEATURE_COVERAGE_PER_POINT: "coverage_per_point",
+	FEATURE_PAWNS:              "pawns",
+	FEATURE_KNIGHTS:            "knights",
+	FEATURE_BISHOPS:            "bishops",
+	FEATURE_ROOKS:              "rooks",
+	FEATURE_QUEENS:             "queens",
+	FEATURE_SUPPORT_EDGES:      "support_edges",
+	FEATURE_SINGLY_COVERED:     "singly_covered",
+	FEATURE_SUPPORTED_PIECES:   "supported_pieces",
+}
+
+// FeatureVector the numeric description of a board consumed by the learned heuristics.  The layout is
+// described by FEATURE_VERSION and FeatureNames
+type FeatureVector [FEATURE_COUNT]float32
+
+// pieceFeatures maps each piece onto its count feature
+var pieceFeatures = map[Piece]int{
+	PAWN:   FEATURE_PAWNS,
+	KNIGHT: FEATURE_KNIGHTS,
+	BISHOP: FEATURE_BISHOPS,
+	ROOK:   FEATURE_ROOKS,
+	QUEEN:  FEATURE_QUEENS,
+}
+
+// Features extracts the FeatureVector of a MinimalBoard.  This rebuilds the support graph, so callers that
+// already hold an inflated Board should use Board.Features instead
+func Features(m MinimalBoard) FeatureVector {
+	board, err := m.RebuildBoard()
+	if err != nil {
+		// a MinimalBoard can only hold known pieces, so this can only happen if the package itself is broken
+		panic(fmt.Sprintf("failed to rebuild board for feature extraction: %v", err))
+	}
+	return board.Features()
+}
+
+// Features extracts the FeatureVector of a settled Board
+func (b *Board) Features() FeatureVector {
+	var result FeatureVector
+	result[FEATURE_BOARD_SIZE] = float32(BOARD_SIZE)
+	for _, row := range b.cells {
+		for _, currCell := range row {
+			supporters := len(currCell.supportedBy)
+			if supporters > 0 {
+				result[FEATURE_COVERAGE]++
+			}
+			if supporters == 1 {
+				result[FEATURE_SINGLY_COVERED]++
+			}
+			result[FEATURE_SUPPORT_EDGES] += float32(supporters)
+			if currCell.piece == NONE {
+				continue
+			}
+			score, err := GetScore(currCell.piece)
+			if err != nil {
+				panic(fmt.Sprintf("failed to score piece for feature extraction: %v", err))
+			}
+			result[FEATURE_SCORE] += float32(score)
+			result[pieceFeatures[currCell.piece]]++
+			if supporters > 0 {
+				result[FEATURE_SUPPORTED_PIECES]++
+			}
+		}
+	}
+	result[FEATURE_UNCOVERED] = float32(BOARD_SIZE*BOARD_SIZE) - result[FEATURE_COVERAGE]
+	if result[FEATURE_SCORE] > 0 {
+		result[FEATURE_COVERAGE_PER_POINT] = result[FEATURE_COVERAGE] / result[FEATURE_SCORE]
+	}
+	return result
+}
@@ -0,0 +1,36 @@
+package chess
+
+import "testing"
+
+func TestFeatures(t *testing.T) {
+	empty := Features(MinimalBoard{})
+	if empty[FEATURE_BOARD_SIZE] != float32(BOARD_SIZE) {
+		t.Errorf("unexpected board size feature: %f", empty[FEATURE_BOARD_SIZE])
+	}
+	if empty[FEATURE_UNCOVERED] != float32(BOARD_SIZE*BOARD_SIZE) {
+		t.Errorf("empty board should be entirely uncovered: %f", empty[FEATURE_UNCOVERED])
+	}
+	if empty[FEATURE_COVERAGE_PER_POINT] != 0 {
+		t.Errorf("empty board should have no coverage per point: %f", empty[FEATURE_COVERAGE_PER_POINT])
+	}
+
+	minimalBoard, expectedScore, _ := getBasicCompleteRookBoard()
+	features := Features(minimalBoard)
+	expected := map[int]float32{
+		FEATURE_SCORE:     float32(expectedScore),
+		FEATURE_COVERAGE:  float32(BOARD_SIZE * BOARD_SIZE),
+		FEATURE_UNCOVERED: 0,
+		FEATURE_ROOKS:     float32(BOARD_SIZE),
+		FEATURE_QUEENS:    0,
+		// every rook covers its own column, plus its neighbours in the row
+		FEATURE_SUPPORT_EDGES: float32((BOARD_SIZE * (BOARD_SIZE - 1)) + ((BOARD_SIZE - 1) * 2)),
+		// every cell off the rook row, plus the two corners of the rook row
+		FEATURE_SINGLY_COVERED:   float32((BOARD_SIZE * (BOARD_SIZE - 1)) + 2),
+		FEATURE_SUPPORTED_PIECES: float32(BOARD_SIZE),
+	}
+	for index, value := range expected {
+		if features[index] != value {
+			t.Errorf("unexpected value for %s.  wanted %f but got %f", FeatureNames[index], value, features[index])
+		}
+	}
+}
@@ -71,18 +71,49 @@ func getCoverage(board *Board, p point, piece Piece) (pointSet, error) {
 }
 
 func pawnCoverage(p point) pointSet {
-	var result pointSet = make(map[point]struct{})
+	result := make(pointSet)
+	addPawnCoverage(p, result)
+	return result
+}
+
+func knightCoverage(p point) pointSet {
+	result := make(pointSet)
+	addKnightCoverage(p, result)
+	return result
+}
+
+func bishopCoverage(board *Board, p point) pointSet {
+	result := make(pointSet)
+	addBishopCoverage(board, p, result)
+	return result
+}
+
+func rookCoverage(board *Board, p point) pointSet {
+	result := make(pointSet)
+	addRookCoverage(board, p, result)
+	return result
+}
+
+// queenCoverage walks the bishop and rook rays into the same set, rather than building both and merging them
+func queenCoverage(board *Board, p point) pointSet {
+	result := make(pointSet, BOARD_SIZE*4)
+	addBishopCoverage(board, p, result)
+	addRookCoverage(board, p, result)
+	return result
+}
+
+// the add*Coverage functions add a piece's coverage to an existing set, so callers can reuse sets
+
+func addPawnCoverage(p point, result pointSet) {
 	if possiblePoint, valid := p.add(1, 1); valid {
 		result.put(possiblePoint)
 	}
 	if possiblePoint, valid := p.add(1, -1); valid {
 		result.put(possiblePoint)
 	}
-	return result
 }
 
-func knightCoverage(p point) pointSet {
-	var result pointSet = make(map[point]struct{})
+func addKnightCoverage(p point, result pointSet) {
 	if possiblePoint, valid := p.add(1, 2); valid {
 		result.put(possiblePoint)
 	}
@@ -107,11 +138,9 @@ func knightCoverage(p point) pointSet {
 	if possiblePoint, valid := p.add(-2, -1); valid {
 		result.put(possiblePoint)
 	}
-	return result
 }
 
-func bishopCoverage(board *Board, p point) pointSet {
-	var result pointSet = make(map[point]struct{})
+func addBishopCoverage(board *Board, p point, result pointSet) {
 	var next point
 	var valid bool
 	for next, valid = p.add(1, 1); valid && board.isEmpty(next); next, valid = next.add(1, 1) {
@@ -139,11 +168,9 @@ func bishopCoverage(board *Board, p point) pointSet {
 	if valid {
 		result.put(next)
 	}
-	return result
 }
 
-func rookCoverage(board *Board, p point) pointSet {
-	var result pointSet = make(map[point]struct{})
+func addRookCoverage(board *Board, p point, result pointSet) {
 	var next point
 	var valid bool
 	for next, valid = p.add(1, 0); valid && board.isEmpty(next); next, valid = next.add(1, 0) {
@@ -170,13 +197,4 @@ func rookCoverage(board *Board, p point) pointSet {
 	if valid {
 		result.put(next)
 	}
-	return result
-}
-
-func queenCoverage(board *Board, p point) pointSet {
-	result := bishopCoverage(board, p)
-	for newP := range rookCoverage(board, p) {
-		result.put(newP)
-	}
-	return result
 }
@@ -0,0 +1,112 @@
+package chess
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EmptyStyle what is drawn on the empty cells of a board
+type EmptyStyle int
+
+// names for all the empty cell styles
+const (
+	// EMPTY_COUNTS the number of pieces supporting the cell.  This is the most detailed, but runs together on
+	// dense boards, and cells with 10 or more supporters push the rest of the row out of line
+	EMPTY_COUNTS EmptyStyle = iota
+	// EMPTY_COVERAGE whether the cell is covered at all
+	EMPTY_COVERAGE
+	// EMPTY_NONE nothing, so only the pieces stand out
+	EMPTY_NONE
+	// EMPTY_SHADING the colour of the square, as on a real chess board
+	EMPTY_SHADING
+)
+
+// names used to select each empty cell style
+var emptyStyleNames = map[string]EmptyStyle{
+	"counts":   EMPTY_COUNTS,
+	"coverage": EMPTY_COVERAGE,
+	"none":     EMPTY_NONE,
+	"shading":  EMPTY_SHADING,
+}
+
+// printable runes for the empty cell styles that don't draw numbers.  Like the piece runes, these stick to
+// characters that every terminal can draw
+const (
+	COVERED_RUNE      = '+'
+	UNCOVERED_RUNE    = '-'
+	LIGHT_SQUARE_RUNE = ' '
+	DARK_SQUARE_RUNE  = '#'
+)
+
+// ParseEmptyStyle looks up an empty cell style by name
+func ParseEmptyStyle(name string) (EmptyStyle, error) {
+	style, ok := emptyStyleNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown empty cell style %q, expected one of %s", name, EmptyStyleNames())
+	}
+	return style, nil
+}
+
+// EmptyStyleNames lists the names accepted by ParseEmptyStyle
+func EmptyStyleNames() string {
+	names := make([]string, 0, len(emptyStyleNames))
+	for name := range emptyStyleNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// RenderOptions controls how a board is drawn.  The zero value draws support counts, and leaves out the heuristic
+type RenderOptions struct {
+	Empty EmptyStyle
+	// Heuristic if set, the board's value under this heuristic is included
+	Heuristic func(board *Board) (float32, error)
+}
+
+// Render draws the board in negative x, y space, followed by a summary line
+func (b *Board) Render(options RenderOptions) string {
+	result := strings.Builder{}
+	for x, row := range b.cells {
+		for y, currCell := range row {
+			if currCell.piece != NONE {
+				result.WriteRune(currCell.piece.GetRune())
+				continue
+			}
+			switch options.Empty {
+			case EMPTY_COVERAGE:
+				if len(currCell.supportedBy) > 0 {
+					result.WriteRune(COVERED_RUNE)
+				} else {
+					result.WriteRune(UNCOVERED_RUNE)
+				}
+			case EMPTY_NONE:
+				result.WriteRune(NONE.GetRune())
+			case EMPTY_SHADING:
+				if (x+y)%2 == 1 {
+					result.WriteRune(DARK_SQUARE_RUNE)
+				} else {
+					result.WriteRune(LIGHT_SQUARE_RUNE)
+				}
+			default:
+				result.WriteString(strconv.Itoa(len(currCell.supportedBy)))
+			}
+		}
+		result.WriteString("\n")
+	}
+	coverage := b.GetCoverageLevel()
+	solved := coverage == BOARD_SIZE*BOARD_SIZE
+	if options.Heuristic == nil {
+		result.WriteString(fmt.Sprintf("Score: %d\tSolved: %t\tCoverage: %d", b.score, solved, coverage))
+		return result.String()
+	}
+	heuristicScore, err := options.Heuristic(b)
+	if err != nil {
+		return fmt.Sprintf("failed to calculate heuristic while rendering: %v", err)
+	}
+	result.WriteString(fmt.Sprintf("Score: %d\tHeuristic: %f\tSolved: %t\tCoverage: %d",
+		b.score, heuristicScore, solved, coverage))
+	return result.String()
+}
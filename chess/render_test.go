@@ -0,0 +1,71 @@
+package chess
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBoard_Render(t *testing.T) {
+	minimalBoard := MinimalBoard{}
+	minimalBoard.board[0] = QUEEN
+	board, err := minimalBoard.RebuildBoard()
+	if err != nil {
+		t.Fatalf("failed to rebuild board: %v", err)
+	}
+	coverage := board.GetCoverageLevel()
+	darkSquares := 0
+	for x := 0; x < BOARD_SIZE; x++ {
+		for y := 0; y < BOARD_SIZE; y++ {
+			if (x+y)%2 == 1 {
+				darkSquares++
+			}
+		}
+	}
+	tests := []struct {
+		name     string
+		style    EmptyStyle
+		expected map[rune]int
+	}{
+		{"counts", EMPTY_COUNTS, map[rune]int{'Q': 1, '1': coverage, '0': BOARD_SIZE*BOARD_SIZE - coverage - 1}},
+		{"coverage", EMPTY_COVERAGE,
+			map[rune]int{'Q': 1, COVERED_RUNE: coverage, UNCOVERED_RUNE: BOARD_SIZE*BOARD_SIZE - coverage - 1}},
+		{"none", EMPTY_NONE, map[rune]int{'Q': 1, NONE.GetRune(): BOARD_SIZE*BOARD_SIZE - 1}},
+		// the queen sits on a light square
+		{"shading", EMPTY_SHADING,
+			map[rune]int{'Q': 1, DARK_SQUARE_RUNE: darkSquares, LIGHT_SQUARE_RUNE: BOARD_SIZE*BOARD_SIZE - darkSquares - 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			style, err := ParseEmptyStyle(tt.name)
+			if err != nil {
+				t.Fatalf("failed to parse style: %v", err)
+			}
+			if style != tt.style {
+				t.Errorf("parsed %q as %d, wanted %d", tt.name, style, tt.style)
+			}
+			rendered := board.Render(RenderOptions{Empty: style})
+			rows := strings.Split(rendered, "\n")
+			if len(rows) != BOARD_SIZE+1 {
+				t.Fatalf("expected %d rows and a summary, got %q", BOARD_SIZE, rendered)
+			}
+			counts := map[rune]int{}
+			for _, row := range rows[:BOARD_SIZE] {
+				if len([]rune(row)) != BOARD_SIZE {
+					t.Errorf("row %q is not %d cells wide", row, BOARD_SIZE)
+				}
+				for _, r := range row {
+					counts[r]++
+				}
+			}
+			for r, expected := range tt.expected {
+				if counts[r] != expected {
+					t.Errorf("expected %d of %q but got %d in\n%s", expected, r, counts[r], rendered)
+				}
+			}
+		})
+	}
+	_, err = ParseEmptyStyle("sparkles")
+	if err == nil {
+		t.Errorf("expected an error for an unknown style")
+	}
+}
@@ -2,11 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/AlexTGMM/chess-coverage-search/chess"
 	"golang.org/x/sync/errgroup"
 	"log"
+	"math"
 	"os"
 	"runtime"
 	"runtime/pprof"
@@ -16,18 +18,61 @@ import (
 )
 
 const (
+	// INITIAL_BEST_SCORE this question makes the assertion that 28 is the best possible score for board size 8,
+	// so let's constrain our solution to that or better
+	// https://puzzling.stackexchange.com/questions/2907/how-many-chess-pieces-are-needed-to-control-every-square-on-the-board-no-piece?lq=1
+	INITIAL_BEST_SCORE     = 28
 	WORK_QUEUE_SIZE_FACTOR = 8
-	// NEW_BOARD_QUEUE_SIZE_FACTOR 5 pieces + 1 reduction per space
-	NEW_BOARD_QUEUE_SIZE_FACTOR = chess.BOARD_SIZE * (5 + 1)
+	// RESULT_QUEUE_SIZE_FACTOR each result holds every board proposed from a single job, which is
+	// up to 5 pieces + 1 reduction per space
+	RESULT_QUEUE_SIZE_FACTOR = 2
 )
 
 // command line flags to control profiling
 var cpuProfile = flag.String("cpuprofile", "", "write cpu profile to file")
 var memProfile = flag.String("memprofile", "", "write memory profile to `file`")
-var timeout = flag.Int("timeout", 5, "profiling shutdown timeout in seconds")
+
+// command line flags to control the length of the run
+var maxDuration = flag.Duration("max-duration", 0, "stop the search after this long, 0 to run until the search is exhausted")
+
+// command line flags to control the search
+var heuristicSpec = flag.String("heuristic", "default", "heuristic used to order the edge set, as `name[:arg]`")
+var partitions = flag.Int("partitions", 1, "number of independent worker groups to split the root's first placements across")
+var deterministic = flag.Bool("deterministic", false, "search in lock-step rounds so runs with the same seed produce identical solutions")
+var seed = flag.Int64("seed", 0, "seed used to break ties between equally good boards in deterministic runs with the sorted frontier")
+
+// command line flags to control the output
+var display = flag.String("display", "counts", "what to draw on empty cells: "+chess.EmptyStyleNames())
+
+// heuristic the heuristic selected by -heuristic
+var heuristic heuristicFunc
+
+// renderOptions how boards are drawn, as selected by -display
+var renderOptions chess.RenderOptions
 
 func main() {
+	// run failures are exited with from here, rather than with log.Fatal, so the other deferred
+	// functions still get to write out profiles and traces
+	exitCode := 0
+	defer func() { os.Exit(exitCode) }()
 	flag.Parse()
+	var err error
+	renderOptions.Empty, err = chess.ParseEmptyStyle(*display)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// the only subcommand is replay, everything else is configured with flags
+	switch {
+	case flag.NArg() == 0:
+	case flag.NArg() == 2 && flag.Arg(0) == "replay":
+		err := replay(flag.Arg(1))
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	default:
+		log.Fatalf("unexpected arguments %v, expected none or: replay <trace file>", flag.Args())
+	}
 	// set up cpu the profiler
 	if *cpuProfile != "" {
 		f, err := os.Create(*cpuProfile)
@@ -60,262 +105,520 @@ func main() {
 		}
 	}()
 
+	var cleanup func() error
+	heuristic, cleanup, err = parseHeuristic(*heuristicSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	renderOptions.Heuristic = heuristic.single
+	if cleanup != nil {
+		defer func() {
+			err := cleanup()
+			if err != nil {
+				log.Printf("failed to clean up heuristic: %v", err)
+			}
+		}()
+	}
+
 	cores := runtime.NumCPU()
 	// make sure Go actually uses the extra cores
 	runtime.GOMAXPROCS(cores)
+	// every component shuts down when this context is done, so the deadline is the only way a run is cut short
+	ctx := context.Background()
+	if *maxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *maxDuration)
+		defer cancel()
+	}
+	if *traceFile != "" {
+		trace, err = newTraceWriter(*traceFile, cores, INITIAL_BEST_SCORE)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer func() {
+			err := trace.close()
+			if err != nil {
+				log.Printf("failed to close trace: %v", err)
+			}
+		}()
+	}
 	// run the solver
-	err := run(cores)
+	solver, err := NewSolver(cores)
 	if err != nil {
 		log.Fatal(err)
 	}
+	err = solver.Run(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Printf("stopping after reaching the maximum duration of %v", *maxDuration)
+		markIncomplete(fmt.Sprintf("the search was stopped after the maximum duration of %v", *maxDuration))
+		err = nil
+	}
+	log.Print(summary(err))
+	if err != nil {
+		log.Print(err)
+		exitCode = 1
+	}
 }
 
-// how many boards the workers have handled
-var processed = atomic.Int64{}
+// the best solution score.  This is the only search state shared between groups
+var currBestScore = atomic.Int32{}
 
-// how many boards were presented back to the orchestrator that it had already seen
-var duplicates = atomic.Int64{}
+// job a board for a worker to expand.  index identifies the job within a deterministic round
+type job struct {
+	index int
+	board chess.MinimalBoard
+}
 
-// the best solution score
-var currBestScore = atomic.Int32{}
+// jobResult every acceptable board proposed from a single job
+type jobResult struct {
+	index int
+	// the board the job expanded
+	board  chess.MinimalBoard
+	boards []chess.MinimalBoard
+	// boards the worker went on to expand itself while plunging, which only need to be marked seen
+	expanded []chess.MinimalBoard
+	// where the children of each expanded board start in boards.  Anything before the first split is a child
+	// of the job's own board
+	splits []int
+}
 
-// how many boards are the workers currently handling.  Used for safe shutdown
-var outstandingJobs = atomic.Int32{}
+// parentOf finds which board the i'th board was proposed from
+func (r *jobResult) parentOf(i int) chess.MinimalBoard {
+	return r.expandedParent(sort.SearchInts(r.splits, i+1))
+}
 
-// the following two data structures account for the vast majority of memory used by the algorithm
-// keep track of the unique boards the orchestrator has seen.  This grows monotonically
-var seenBoards = chess.MinimalBoardSet{}
+// expandedParent finds which board the k'th expanded board was proposed from
+func (r *jobResult) expandedParent(k int) chess.MinimalBoard {
+	if k == 0 {
+		return r.board
+	}
+	return r.expanded[k-1]
+}
 
-// the orchestrators edge set of boards yet to be sent back to the workers.  This
-// grows much faster than it shrinks
-var edgeSet []chess.MinimalBoard
+// group is an orchestrator, its workers, and the state they search over.  Normally the whole search is a
+// single group, but the root's first placements can be partitioned across several groups.  Groups share
+// nothing but the bound, so they duplicate some work, but they also don't contend over a single seen set
+// and edge set, which become the bottleneck on machines with many cores
+type group struct {
+	id int
+	// the following two data structures account for the vast majority of memory used by the algorithm
+	// keep track of the unique boards the orchestrator has seen.  This grows monotonically, unless
+	// -max-frontier is set
+	seenBoards chess.BoardKeySet
+	// the orchestrators edge set of boards yet to be sent back to the workers.  This
+	// grows much faster than it shrinks
+	edgeSet frontier
 
-func run(cores int) error {
-	// this question makes the assertion that 28 is the best possible score for board size 8,
-	// so let's constrain our solution to that or better
-	// https://puzzling.stackexchange.com/questions/2907/how-many-chess-pieces-are-needed-to-control-every-square-on-the-board-no-piece?lq=1
-	currBestScore.Store(28)
+	workers       int
+	workQueueSize int
+	workQueue     chan job
+	resultQueue   chan jobResult
+
+	// only kept with -max-frontier.  Where each board still in use came from, so it can be regenerated if it's
+	// forgotten.  How many boards in the seen set have been searched, the order they finished in, and the bound
+	// they were last checked against.  The backed up score of each parent waiting in the edge set to regenerate
+	// its forgotten children, and the bound those were last checked against
+	lineage          map[chess.BoardKey]lineage
+	finished         int
+	finishedOrder    []chess.BoardKey
+	finishedBound    int32
+	regenerating     map[chess.BoardKey]int
+	regeneratedBound int32
+
+	// how many boards are the workers currently handling.  Used for safe shutdown
+	outstandingJobs atomic.Int32
+	// sizes of seenBoards and edgeSet, published for the drawer
+	seenCount    atomic.Int64
+	edgeSetCount atomic.Int64
+	// how many boards this group's workers have handled, how many boards were presented back to the
+	// orchestrator that it had already seen, and how many were forgotten to stay within -max-frontier
+	processed  atomic.Int64
+	duplicates atomic.Int64
+	evicted    atomic.Int64
+}
+
+// lowerBound lowers the shared bound to score, if score is better
+func lowerBound(score int) bool {
+	for {
+		bound := currBestScore.Load()
+		if int32(score) >= bound {
+			return false
+		}
+		if currBestScore.CompareAndSwap(bound, int32(score)) {
+			return true
+		}
+	}
+}
 
-	// create an empty board to use as the solution root
-	baseBoard := chess.MinimalBoard{}
-	seenBoards.Put(baseBoard)
-	edgeSet = append(edgeSet, baseBoard)
+func newGroup(id, workers int, roots []chess.MinimalBoard) (*group, error) {
+	workQueueSize := workers * WORK_QUEUE_SIZE_FACTOR
+	g := &group{
+		id:            id,
+		seenBoards:    chess.BoardKeySet{},
+		workers:       workers,
+		workQueueSize: workQueueSize,
+		workQueue:     make(chan job, workQueueSize),
+		resultQueue:   make(chan jobResult, workers*RESULT_QUEUE_SIZE_FACTOR),
+	}
+	var discard func(chess.MinimalBoard)
+	if *maxFrontier > 0 {
+		g.lineage = map[chess.BoardKey]lineage{}
+		g.regenerating = map[chess.BoardKey]int{}
+		g.regeneratedBound = currBestScore.Load()
+		// nothing has been checked yet
+		g.finishedBound = math.MaxInt32
+		discard = g.discarded
+	}
+	var err error
+	g.edgeSet, err = newFrontier(workQueueSize, discard)
+	if err != nil {
+		return nil, err
+	}
+	// the empty board is never proposed, so it only needs to be marked seen if it's actually a root.  Roots
+	// have no parent, so they're never forgotten.  A partition's roots can't fall back on the empty board,
+	// since that would expand every other group's roots too
+	for _, root := range roots {
+		g.insertBoard(root)
+	}
+	_, err = g.settleEdgeSet(len(roots))
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
 
+// NewSolver sets up a search over the given number of cores, ready to Run.  It fails while another Solver is
+// running, since they would share the bound and the best solution
+func NewSolver(cores int) (*Solver, error) {
+	if solverRunning.Load() {
+		return nil, errors.New("another solver is already running")
+	}
+	currBestScore.Store(INITIAL_BEST_SCORE)
+	bestSolution.Store(nil)
+	incomplete.Store(nil)
+	err := checkStrategy()
+	if err != nil {
+		return nil, err
+	}
 	// hoping that this will end up with one core running the orchestrator, the rest
 	// of the cores running a worker, and the drawing thread bouncing between threads
 	// as available
 	// follow up:  profiling has confirmed this hunch is roughly what happens
 	workers := cores - 1
-	workQueueSize := workers * WORK_QUEUE_SIZE_FACTOR
+	groups, err := makeGroups(*partitions, workers)
+	if err != nil {
+		return nil, err
+	}
+	return &Solver{groups: groups, started: time.Now()}, nil
+}
+
+// Run searches until the search is exhausted, or ctx is done.  A Solver can only be run once, and not while
+// another Solver is running
+func (s *Solver) Run(ctx context.Context) error {
+	if !solverRunning.CompareAndSwap(false, true) {
+		return errors.New("another solver is already running")
+	}
+	defer solverRunning.Store(false)
+	groups := s.groups
 	// set up the threading components
-	eg, egctx := errgroup.WithContext(context.Background())
-	workQueue := make(chan chess.MinimalBoard, workQueueSize)
-	newBoardQueue := make(chan chess.MinimalBoard, workers*NEW_BOARD_QUEUE_SIZE_FACTOR)
+	eg, egctx := errgroup.WithContext(ctx)
 	drawingQueue := make(chan chess.MinimalBoard)
 
 	// start the threads
-	for i := 0; i < workers; i++ {
-		worker := makeWorker(egctx, workQueue, newBoardQueue)
-		eg.Go(worker)
+	orchestrators := errgroup.Group{}
+	for _, g := range groups {
+		for i := 0; i < g.workers; i++ {
+			eg.Go(makeWorker(egctx, g))
+		}
+		if !*deterministic {
+			orchestrators.Go(makeOrchestrator(egctx, g, drawingQueue))
+		}
+	}
+	if *deterministic {
+		orchestrators.Go(makeDeterministicCoordinator(egctx, groups, drawingQueue))
+	}
+	// the drawer and watchdog are shared, so they can only be told to stop once every group is finished
+	finished := make(chan struct{})
+	eg.Go(func() error {
+		err := orchestrators.Wait()
+		close(drawingQueue)
+		close(finished)
+		return err
+	})
+	eg.Go(makeBoardDrawer(egctx, s, drawingQueue))
+	if *watchdogPeriod > 0 {
+		eg.Go(makeWatchdog(egctx, groups, finished))
 	}
-	eg.Go(makeOrchestrator(egctx, workQueueSize, workQueue, newBoardQueue, drawingQueue))
-	eg.Go(makeBoardDrawer(egctx, workQueue, newBoardQueue, drawingQueue))
 
 	return eg.Wait()
 }
 
-// heuristic is a heuristic based on board coverage slightly biased towards piece efficiency
-// NB: it is not admissible, so this isn't true A*
-func heuristic(board *chess.Board) (float32, error) {
-	score, err := board.Score()
+// makeGroups splits the search into groups.  A single group searches from the empty board.  Multiple groups
+// each search from a share of the empty board's proposals, dealt out in heuristic order so every group gets a
+// similar mix of good and bad starts
+func makeGroups(count, workers int) ([]*group, error) {
+	if count < 1 {
+		return nil, fmt.Errorf("partitions must be at least 1, got %d", count)
+	}
+	if count == 1 {
+		g, err := newGroup(0, max(workers, 1), []chess.MinimalBoard{{}})
+		if err != nil {
+			return nil, err
+		}
+		return []*group{g}, nil
+	}
+	root, err := chess.MinimalBoard{}.RebuildBoard()
+	if err != nil {
+		return nil, fmt.Errorf("failed to rebuild root board: %w", err)
+	}
+	proposedBoards, err := root.ProposeBoards(heuristic, int(currBestScore.Load()))
 	if err != nil {
-		return 0, fmt.Errorf("failed to calculate score during heuristic: %w", err)
+		return nil, fmt.Errorf("failed to propose first placements: %w", err)
+	}
+	firstPlacements := make([]chess.MinimalBoard, 0, len(proposedBoards))
+	for proposedBoard := range proposedBoards {
+		firstPlacements = append(firstPlacements, proposedBoard)
 	}
-	coverage := float32(board.GetCoverageLevel())
-	return (coverage / float32(score)) + coverage, nil
+	sort.Slice(firstPlacements, func(i, j int) bool {
+		return worseBoard(firstPlacements[j], firstPlacements[i])
+	})
+	// there's no point in having groups with nothing to do
+	count = min(count, len(firstPlacements))
+	shares := make([][]chess.MinimalBoard, count)
+	for i, firstPlacement := range firstPlacements {
+		shares[i%count] = append(shares[i%count], firstPlacement)
+	}
+	groups := make([]*group, count)
+	for i, share := range shares {
+		// spread the workers as evenly as possible, but every group needs at least one
+		groupWorkers := workers / count
+		if i < workers%count {
+			groupWorkers++
+		}
+		groups[i], err = newGroup(i, max(groupWorkers, 1), share)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// the root was expanded up front, on behalf of every group
+	groups[0].processed.Add(1)
+	return groups, nil
 }
 
-func makeWorker(ctx context.Context, workQueue, newBoardQueue chan chess.MinimalBoard) func() error {
+func makeWorker(ctx context.Context, g *group) func() error {
 	return func() error {
 		for {
 			// pull a board from the work queue
-			var minimalBoard chess.MinimalBoard
 			select {
-			case b, ok := <-workQueue:
+			case j, ok := <-g.workQueue:
 				if !ok {
 					return nil
 				}
 				// wrap board work in a function, so we can defer reporting the work done
 				err := func() error {
-					defer outstandingJobs.Add(-1)
-					minimalBoard = b
-					// reconstitute the board to begin working on it
-					board, err := minimalBoard.RebuildBoard()
+					defer g.outstandingJobs.Add(-1)
+					// gather boards that could be derived from this board within one game step
+					bound := int(currBestScore.Load())
+					result := jobResult{index: j.index, board: j.board}
+					err := expand(&result, j.board, bound)
 					if err != nil {
 						return err
 					}
-					// gather boards that could be derived from this board within one game step
-					proposedBoards, err := board.ProposeBoards(heuristic)
-					if err != nil {
-						return fmt.Errorf("failed to propose new boards: %w", err)
+					if *strategy == "plunge" {
+						err = g.plunge(&result, j.board, bound)
+						if err != nil {
+							return err
+						}
 					}
-					// add any boards that don't have too high of a score back to the work queue
-					// this is only best effort, so when a new best score is found, some boards with too
-					// high of a score may slip through.  This isn't an issue; they will be caught
-					// later by the orchestrator
-					for proposedBoard := range proposedBoards {
-						if proposedBoard.Score <= int(currBestScore.Load()) {
-							select {
-							case newBoardQueue <- proposedBoard:
-							case <-ctx.Done():
-								return fmt.Errorf("context was closed")
-							}
+					// map iteration order is random, so deterministic runs need the boards in a fixed order.  The
+					// children of each expanded board are sorted separately, so they stay with their parent
+					if *deterministic {
+						start := 0
+						for _, end := range append(result.splits, len(result.boards)) {
+							children := result.boards[start:end]
+							sort.Slice(children, func(i, k int) bool {
+								return children[i].Less(children[k])
+							})
+							start = end
 						}
 					}
-					outstandingJobs.Add(-1)
+					select {
+					case g.resultQueue <- result:
+					case <-ctx.Done():
+						return fmt.Errorf("context was closed on worker: %w", ctx.Err())
+					}
 					return nil
 				}()
+				// a worker that quietly gives up leaves its group short handed, or stalls it entirely, so
+				// any failure takes down the whole run
 				if err != nil {
-					return nil
+					return fmt.Errorf("worker for group %d failed: %w", g.id, err)
 				}
 			case <-ctx.Done():
-				return fmt.Errorf("context was closed")
+				return fmt.Errorf("context was closed on worker: %w", ctx.Err())
 			}
 		}
 	}
 }
 
-func makeOrchestrator(ctx context.Context, workQueueSize int, workQueue, newBoardQueue, drawingQueue chan chess.MinimalBoard) func() error {
+func makeOrchestrator(ctx context.Context, g *group, drawingQueue chan chess.MinimalBoard) func() error {
 	return func() error {
-		var scoreIsDirty bool
-		now := time.Now()
 		for {
 			// if there is work to be done, add a board to the work queue
-			if len(edgeSet) > 0 {
-				// discard best boards from the edge set until the best board has an acceptable score
-				tailIndex := len(edgeSet) - 1
-				for edgeSet[tailIndex].Score > int(currBestScore.Load()) {
-					edgeSet = edgeSet[:tailIndex]
-					tailIndex--
-				}
-				// if there are any boards left, add try to add one to the work queue
-				if len(edgeSet) > 0 {
+			if best, ok := g.edgeSet.best(int(currBestScore.Load())); ok {
+				select {
+				case <-ctx.Done():
+					return fmt.Errorf("context expired on orchestrator: %w", ctx.Err())
+				case g.workQueue <- job{board: best}:
+					// iff the drawing queue is waiting, have it draw a board
 					select {
-					case <-ctx.Done():
-						return fmt.Errorf("context expired on orchestrator")
-					case workQueue <- edgeSet[tailIndex]:
-						// iff the drawing queue is waiting, have it draw a board
-						select {
-						case drawingQueue <- edgeSet[tailIndex]:
-						default:
-						}
-						// pop the board that was added
-						edgeSet = edgeSet[:tailIndex]
-						outstandingJobs.Add(1)
-						processed.Add(1)
+					case drawingQueue <- best:
 					default:
-						// if the input queue isn't ready, just move on immediately
 					}
+					// pop the board that was added
+					g.edgeSet.pop()
+					g.outstandingJobs.Add(1)
+					g.processed.Add(1)
+				default:
+					// if the input queue isn't ready, just move on immediately
 				}
 			}
 			// tracks the number of boards added in one pass
 			var newBoards int
-			// this pulls boards from the work queue until the queue is empty.  This is done because
+			// this pulls results from the result queue until the queue is empty.  This is done because
 			// each worker is relatively slow and usually produces far more output than it consumes in input.
 			// follow up: profiled and verified empirically that this hunch was correct and that workers are
 			// spending effectively no time waiting for input, even though the producer spends very little time
 			// producing it
-		newBoardLoop:
+		resultLoop:
 			for {
 				select {
 				case <-ctx.Done():
-					return fmt.Errorf("context expired on orchestrator")
-				case newBoard, ok := <-newBoardQueue:
+					return fmt.Errorf("context expired on orchestrator: %w", ctx.Err())
+				case result, ok := <-g.resultQueue:
 					if !ok {
-						return fmt.Errorf("new board channel was unexpectedly closed")
+						return fmt.Errorf("result channel was unexpectedly closed")
 					}
-					// if the new board is already solved, update the score and print it
-					if newBoard.IsSolved {
-						if newBoard.IsSolved && newBoard.Score < int(currBestScore.Load()) {
-							currBestScore.Store(int32(newBoard.Score))
-							scoreIsDirty = true
-						}
-						// when printing solved boards, wait for the drawing thread to be ready, so
-						// we don't miss any solutions
-						select {
-						case <-ctx.Done():
-							return fmt.Errorf("context expired on orchestrator while drawing solution")
-						case drawingQueue <- newBoard:
+					for k, expandedBoard := range result.expanded {
+						if g.markExpanded(expandedBoard) {
+							g.adopt(expandedBoard, result.expandedParent(k))
 						}
-					} else {
-						// if the new board isn't solved, add it to the edge set to be sorted
-						insertBoard(newBoard)
 					}
-					newBoards++
-				default:
-					// as soon as there new boards left in the queue, stop pulling
-					break newBoardLoop
-				}
-				// this is the termination condition.  We terminate if we can't find any more boards to check
-				// or if the profiling timout has expired
-				if ((*cpuProfile != "" || *memProfile != "") && now.Add(time.Duration(*timeout)*time.Second).Before(time.Now())) ||
-					(len(edgeSet) == 0 &&
-						len(workQueue) == 0 &&
-						len(newBoardQueue) == 0 &&
-						outstandingJobs.Load() == 0) {
-					close(workQueue)
-					close(drawingQueue)
-					// hack to make sure the workers stop if we're ending early to get the dump.  Without this,
-					// workers can end up hung, waiting to write back to the result queue, trigger a panic and
-					// prevent the profiling from being written.  The other option would be to busy wait on outstandingJobs
-					if *cpuProfile != "" || *memProfile != "" {
-					drain:
-						for {
+					for i, newBoard := range result.boards {
+						// if the new board is already solved, update the score and print it
+						if newBoard.IsSolved {
+							recordSolution(newBoard)
+							// when printing solved boards, wait for the drawing thread to be ready, so
+							// we don't miss any solutions
 							select {
-							case <-newBoardQueue:
-							case <-time.NewTicker(50 * time.Millisecond).C:
-								break drain
+							case <-ctx.Done():
+								return fmt.Errorf("context expired on orchestrator while drawing solution: %w", ctx.Err())
+							case drawingQueue <- newBoard:
+							}
+						} else {
+							// if the new board isn't solved, add it to the edge set to be sorted
+							if g.insertBoard(newBoard) {
+								g.adopt(newBoard, result.parentOf(i))
 							}
 						}
 					}
-					return nil
+					g.merged(&result)
+					newBoards += len(result.boards)
+				default:
+					// as soon as there are no results left in the queue, stop pulling
+					break resultLoop
 				}
 			}
-			// only sort the boards we may plan to use, unless the score has changed.  If
-			// the score has changed, sort them all since we don't know how many may get discarded
-			// TODO: might it be better to actually discard the boards that are no long in bounds,
-			// and still only sort the tip of the edge set?  Probably.  Try this next
-			offset := len(edgeSet) - (newBoards + workQueueSize)
-			if offset < 0 || scoreIsDirty {
-				offset = 0
-				scoreIsDirty = false
+			// this is the termination condition.  We terminate if we can't find any more boards to check.
+			// outstandingJobs must be checked first.  Workers only finish a job after queueing its result, so
+			// once it reads zero, the queues can't be refilled behind our back
+			if g.outstandingJobs.Load() == 0 &&
+				len(g.workQueue) == 0 &&
+				len(g.resultQueue) == 0 &&
+				g.edgeSet.len() == 0 {
+				close(g.workQueue)
+				return nil
+			}
+			_, err := g.settleEdgeSet(newBoards)
+			if err != nil {
+				return fmt.Errorf("failed to settle edge set of group %d: %w", g.id, err)
 			}
-			sort.Slice(edgeSet[offset:], func(i, j int) bool {
-				return edgeSet[offset+i].Heuristic < edgeSet[offset+j].Heuristic
-			})
 		}
 	}
 }
 
 // insertBoard handles the bookkeeping for adding to the edge set
-func insertBoard(minimalBoard chess.MinimalBoard) bool {
-	if !seenBoards.Contains(minimalBoard) {
-		seenBoards.Put(minimalBoard)
-		edgeSet = append(edgeSet, minimalBoard)
+func (g *group) insertBoard(minimalBoard chess.MinimalBoard) bool {
+	if !g.seenBoards.Contains(minimalBoard) {
+		g.hold(minimalBoard.Key())
+		g.seenBoards.Put(minimalBoard)
+		g.edgeSet.push(minimalBoard)
+		g.seenCount.Add(1)
 		return true
 	}
-	duplicates.Add(1)
+	g.duplicates.Add(1)
 	return false
 }
 
+// markExpanded marks a board seen without adding it to the edge set, since it has already been expanded.  The
+// board is held until its job's result has been merged, so its children can be adopted.  Returns whether the
+// board is new to the group, or had already been searched and needs a parent again
+func (g *group) markExpanded(minimalBoard chess.MinimalBoard) bool {
+	searched := g.hold(minimalBoard.Key())
+	if g.seenBoards.Contains(minimalBoard) {
+		return searched
+	}
+	g.seenBoards.Put(minimalBoard)
+	g.seenCount.Add(1)
+	return true
+}
+
+// settleEdgeSet lets the edge set reorganize itself after a batch of new boards, and forgets boards if the
+// group has grown too large.  Returns how many boards were forgotten
+func (g *group) settleEdgeSet(newBoards int) (int, error) {
+	g.edgeSet.settle(newBoards, currBestScore.Load())
+	forgotten, err := g.evict()
+	g.edgeSetCount.Store(int64(g.edgeSet.len()))
+	return forgotten, err
+}
+
+// worseBoard orders boards from worst to best.  Heuristic ties are broken by the board itself, and in
+// deterministic runs first by a seeded hash of it, so that the order doesn't depend on the order the boards
+// arrived in
+func worseBoard(a, b chess.MinimalBoard) bool {
+	if a.Heuristic != b.Heuristic {
+		return a.Heuristic < b.Heuristic
+	}
+	if *deterministic {
+		aHash, bHash := seededHash(a), seededHash(b)
+		if aHash != bHash {
+			return aHash < bHash
+		}
+	}
+	return a.Less(b)
+}
+
+// seededHash is FNV-1a over the seed and the board's pieces
+func seededHash(board chess.MinimalBoard) uint64 {
+	const prime = 1099511628211
+	hash := uint64(14695981039346656037)
+	for i := 0; i < 64; i += 8 {
+		hash = (hash ^ uint64(byte(*seed>>i))) * prime
+	}
+	for _, piece := range board.Key() {
+		hash = (hash ^ uint64(piece)) * prime
+	}
+	return hash
+}
+
 // an unbuffered drawing thread that draws on a best effort basis.  Useful for debugging and algorithm grokking
-func makeBoardDrawer(ctx context.Context, workQueue, newBoardQueue, boardDrawerQueue chan chess.MinimalBoard) func() error {
+func makeBoardDrawer(ctx context.Context, solver *Solver, boardDrawerQueue chan chess.MinimalBoard) func() error {
 	return func() error {
 		var foundAnswer bool
 		for {
 			select {
 			case <-ctx.Done():
-				return fmt.Errorf("context expired on board drawer")
+				return fmt.Errorf("context expired on board drawer: %w", ctx.Err())
 			case newBoard, ok := <-boardDrawerQueue:
 				if newBoard.IsSolved {
 					foundAnswer = true
@@ -329,9 +632,10 @@ func makeBoardDrawer(ctx context.Context, workQueue, newBoardQueue, boardDrawerQ
 					if err != nil {
 						log.Printf("failed to rebuild board while drawing: %v", err)
 					}
-					log.Printf("\n%s\nseen: %d\tduplicates: %d\tcurrent: %d\tqueued: %d\tprospects: %d\tprocessed: %d",
-						rebuiltBoard.String(heuristic),
-						len(seenBoards), duplicates.Load(), len(edgeSet), len(workQueue), len(newBoardQueue), processed.Load())
+					stats := solver.Stats()
+					log.Printf("\n%s\nseen: %d\tduplicates: %d\tcurrent: %d\tqueued: %d\tprospects: %d\tprocessed: %d (%.0f/s)",
+						rebuiltBoard.Render(renderOptions), stats.Seen, stats.Duplicates, stats.Frontier,
+						stats.Queued, stats.Prospects, stats.Processed, stats.ProcessedPerSecond)
 				}
 			}
 		}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"github.com/AlexTGMM/chess-coverage-search/chess"
+	"testing"
+)
+
+// drain empties a group's edge set, best first
+func drain(g *group) []chess.MinimalBoard {
+	var result []chess.MinimalBoard
+	for {
+		board, ok := g.edgeSet.best(INITIAL_BEST_SCORE)
+		if !ok {
+			return result
+		}
+		g.edgeSet.pop()
+		result = append(result, board)
+	}
+}
+
+func TestMakeGroups(t *testing.T) {
+	defer func(previous heuristicFunc) { heuristic = previous }(heuristic)
+	heuristic = eachBoard(defaultHeuristic)
+	currBestScore.Store(INITIAL_BEST_SCORE)
+	firstPlacements := proposeSorted(t, chess.MinimalBoard{})
+
+	_, err := makeGroups(0, 1)
+	if err == nil {
+		t.Errorf("expected an error for no partitions")
+	}
+
+	// a single group searches from the empty board
+	groups, err := makeGroups(1, 0)
+	if err != nil {
+		t.Fatalf("failed to make groups: %v", err)
+	}
+	if len(groups) != 1 || groups[0].workers != 1 {
+		t.Fatalf("expected a single group with a single worker, got %d groups", len(groups))
+	}
+	if roots := drain(groups[0]); len(roots) != 1 || roots[0] != (chess.MinimalBoard{}) {
+		t.Errorf("expected the single group to start from the empty board, got %d roots", len(roots))
+	}
+
+	// first placements are dealt out round robin in heuristic order, and the workers as evenly as possible
+	groups, err = makeGroups(3, 7)
+	if err != nil {
+		t.Fatalf("failed to make groups: %v", err)
+	}
+	if len(groups) != 3 {
+		t.Fatalf("expected 3 groups, got %d", len(groups))
+	}
+	for i, g := range groups {
+		if expected := []int{3, 2, 2}[i]; g.workers != expected {
+			t.Errorf("expected group %d to have %d workers, got %d", i, expected, g.workers)
+		}
+		roots := drain(g)
+		var expected []chess.MinimalBoard
+		for k := i; k < len(firstPlacements); k += len(groups) {
+			expected = append(expected, firstPlacements[k])
+		}
+		if len(roots) != len(expected) {
+			t.Fatalf("expected group %d to get %d first placements, got %d", i, len(expected), len(roots))
+		}
+		for k := range roots {
+			if roots[k] != expected[k] {
+				t.Errorf("group %d got first placement %d out of turn:\n%v", i, k, roots[k])
+			}
+		}
+	}
+
+	// more partitions than workers still gives every group a worker, and more partitions than first
+	// placements only makes as many groups as there are first placements
+	groups, err = makeGroups(len(firstPlacements)+5, 2)
+	if err != nil {
+		t.Fatalf("failed to make groups: %v", err)
+	}
+	if len(groups) != len(firstPlacements) {
+		t.Fatalf("expected %d groups, got %d", len(firstPlacements), len(groups))
+	}
+	for i, g := range groups {
+		if g.workers != 1 {
+			t.Errorf("expected group %d to have a single worker, got %d", i, g.workers)
+		}
+		if roots := drain(g); len(roots) != 1 || roots[0] != firstPlacements[i] {
+			t.Errorf("expected group %d to start from first placement %d alone, got %d roots", i, i, len(roots))
+		}
+	}
+}
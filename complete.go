@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/AlexTGMM/chess-coverage-search/chess"
+	"sync/atomic"
+)
+
+// command line flags to control completeness
+var complete = flag.Bool("complete", false, "search exhaustively up to the final bound, and report whether the best score found is proven optimal")
+
+// incomplete the first reason the search stopped being exhaustive, or nil while it still is.
+//
+// Pruning by score never loses an optimal cover.  Every subset of a cover scores no more than the cover, and
+// a cover can always be reached through its own subsets: some piece of the cover that's missing from a partial
+// board must cover a cell that's still uncovered, since the partial board's pieces only cover more with fewer
+// pieces in the way, and reducing away pieces that don't contribute never loses coverage.  Dedup is exact,
+// plunging returns every child it passes over, and forgotten boards are regenerated from their parents unless
+// the bound could prune them, so the only ways to lose part of the search are the ones recorded here
+var incomplete atomic.Pointer[string]
+
+// markIncomplete records that part of the search space was skipped.  Only the first reason is kept
+func markIncomplete(reason string) {
+	incomplete.CompareAndSwap(nil, &reason)
+}
+
+// bestSolution the best solution found so far, or nil if nothing has been solved yet
+var bestSolution atomic.Pointer[chess.MinimalBoard]
+
+// recordSolution keeps a solution if it's the best so far, and lowers the bound to match
+func recordSolution(solution chess.MinimalBoard) bool {
+	for {
+		best := bestSolution.Load()
+		if best != nil && best.Score <= solution.Score {
+			break
+		}
+		if bestSolution.CompareAndSwap(best, &solution) {
+			break
+		}
+	}
+	return lowerBound(solution.Score)
+}
+
+// summary describes the outcome of a run that ended with err.  A result is only called optimal under
+// -complete, and only if nothing was skipped along the way
+func summary(err error) string {
+	best := bestSolution.Load()
+	if !*complete {
+		if best == nil {
+			return "no solution found"
+		}
+		return fmt.Sprintf("best solution:\n%s", renderSolution(*best))
+	}
+	reason := incomplete.Load()
+	if reason == nil && err != nil {
+		failed := fmt.Sprintf("the run failed: %v", err)
+		reason = &failed
+	}
+	switch {
+	case reason != nil && best == nil:
+		return fmt.Sprintf("no solution found, and the search is not complete: %s", *reason)
+	case reason != nil:
+		return fmt.Sprintf("best solution:\n%s\nnot proven optimal: %s", renderSolution(*best), *reason)
+	case best == nil:
+		return fmt.Sprintf("proven that no cover scores %d or less", INITIAL_BEST_SCORE)
+	default:
+		return fmt.Sprintf("best solution:\n%s\nproven optimal: the search was exhausted at score %d",
+			renderSolution(*best), best.Score)
+	}
+}
+
+// renderSolution draws a solution the same way the drawer does, as selected by -display
+func renderSolution(solution chess.MinimalBoard) string {
+	board, err := solution.RebuildBoard()
+	if err != nil {
+		return fmt.Sprintf("%s\nfailed to rebuild board while rendering: %v", solution, err)
+	}
+	return board.Render(renderOptions)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSummary(t *testing.T) {
+	defer func() {
+		*complete = false
+		incomplete.Store(nil)
+		bestSolution.Store(nil)
+	}()
+	*complete = true
+	currBestScore.Store(INITIAL_BEST_SCORE)
+	if got := summary(nil); !strings.HasPrefix(got, "proven that no cover") {
+		t.Errorf("an exhausted search with no solution should prove there is none, got %q", got)
+	}
+	worse, better := makeTestBoard(10, 20), makeTestBoard(10, 15)
+	recordSolution(better)
+	recordSolution(worse)
+	if best := bestSolution.Load(); best == nil || *best != better {
+		t.Errorf("expected the better solution to be kept, got %v", best)
+	}
+	if currBestScore.Load() != 15 {
+		t.Errorf("expected the bound to drop to 15, got %d", currBestScore.Load())
+	}
+	if got := summary(nil); !strings.Contains(got, "proven optimal") {
+		t.Errorf("an exhausted search should be proven optimal, got %q", got)
+	}
+	// the solution is drawn the same way as the drawer draws boards
+	if got, rendered := summary(nil), renderSolution(better); !strings.Contains(got, rendered) ||
+		!strings.Contains(rendered, "Coverage: ") {
+		t.Errorf("expected the solution to be rendered, got %q", got)
+	}
+	if got := summary(errors.New("boom")); !strings.Contains(got, "not proven optimal: the run failed: boom") {
+		t.Errorf("a failed run can't be proven optimal, got %q", got)
+	}
+	markIncomplete("first")
+	markIncomplete("second")
+	if got := summary(nil); !strings.HasSuffix(got, "not proven optimal: first") {
+		t.Errorf("expected the first reason to be kept, got %q", got)
+	}
+	*complete = false
+	if got := summary(nil); strings.Contains(got, "proven") {
+		t.Errorf("optimality should only be reported with -complete, got %q", got)
+	}
+}
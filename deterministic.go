@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/AlexTGMM/chess-coverage-search/chess"
+	"golang.org/x/sync/errgroup"
+)
+
+// roundResult what a group produced in a single deterministic round
+type roundResult struct {
+	// the group has run out of boards, and its work queue has been closed
+	finished  bool
+	solutions []chess.MinimalBoard
+	// a summary of the round for the trace
+	event traceEvent
+}
+
+// makeDeterministicCoordinator replaces the orchestrators for -deterministic runs.  The free running
+// orchestrators depend on the timing of the workers in too many ways to ever be repeatable: which results
+// arrive first decides what is a duplicate, and the bound can change part way through a pass.  Instead, the
+// search proceeds in lock-step rounds.  In each round every group sends out a fixed number of its best boards
+// and waits for all of them to come back, then merges the results in job order.  The bound is only lowered
+// between rounds, and solutions are merged in group order, so the same seed always yields the same solutions
+// in the same order, as long as the core count is the same.  The number of boards sent out each round scales
+// with the workers, so a different core count searches in different rounds.  The seed only breaks ties in the
+// sorted frontier, so with -frontier=bucket it has no effect
+func makeDeterministicCoordinator(ctx context.Context, groups []*group, drawingQueue chan chess.MinimalBoard) func() error {
+	return func() error {
+		finished := make([]bool, len(groups))
+		// stop closes the work queues of any groups that are still running, and records how the run ended
+		stop := func(round int, truncated bool) error {
+			for i, g := range groups {
+				if !finished[i] {
+					close(g.workQueue)
+				}
+			}
+			err := record(traceEvent{Type: "end", Round: round, Truncated: truncated})
+			if errors.Is(err, errTraceEnded) {
+				return nil
+			}
+			return err
+		}
+		for round := 0; ; round++ {
+			results := make([]roundResult, len(groups))
+			eg, egctx := errgroup.WithContext(ctx)
+			for i, g := range groups {
+				if finished[i] {
+					continue
+				}
+				i, g := i, g
+				eg.Go(func() error {
+					var err error
+					results[i], err = g.round(egctx, drawingQueue)
+					return err
+				})
+			}
+			err := eg.Wait()
+			// groups that ran out of boards have already closed their work queues, so they have to be marked
+			// finished before anything else can close the rest
+			for i, result := range results {
+				if result.finished {
+					finished[i] = true
+				}
+			}
+			// if the run is being cut short, note that the trace is incomplete before shutting down
+			if ctx.Err() != nil {
+				stopErr := stop(round, true)
+				if stopErr != nil {
+					return stopErr
+				}
+				return fmt.Errorf("context expired on coordinator: %w", ctx.Err())
+			}
+			if err != nil {
+				return err
+			}
+			// nothing has been drawn yet, so merging the solutions here keeps the bound and the drawing
+			// independent of which group finished its round first
+			done := true
+			for i, result := range results {
+				if finished[i] {
+					continue
+				}
+				done = false
+				result.event.Round = round
+				err = record(result.event)
+				if errors.Is(err, errTraceEnded) {
+					// a replay has caught up with the end of an interrupted trace, so there's nothing left to check
+					return stop(round, true)
+				}
+				if err != nil {
+					return err
+				}
+				for _, solution := range result.solutions {
+					recordSolution(solution)
+					err = record(traceEvent{Type: "solution", Round: round, Group: i,
+						Score: solution.Score, Board: traceBoard(solution)})
+					if errors.Is(err, errTraceEnded) {
+						return stop(round, true)
+					}
+					if err != nil {
+						return err
+					}
+					select {
+					case <-ctx.Done():
+						return fmt.Errorf("context expired on coordinator while drawing solution: %w", ctx.Err())
+					case drawingQueue <- solution:
+					}
+				}
+			}
+			if done {
+				return stop(round, false)
+			}
+		}
+	}
+}
+
+// record passes an event to the tracer, if the run is being traced
+func record(event traceEvent) error {
+	if trace == nil {
+		return nil
+	}
+	return trace.record(event)
+}
+
+// round sends the group's best boards to its workers, waits for all of them to be expanded, and then merges
+// the results in the order the boards were sent
+func (g *group) round(ctx context.Context, drawingQueue chan chess.MinimalBoard) (roundResult, error) {
+	bound := currBestScore.Load()
+	result := roundResult{event: traceEvent{Type: "round", Group: g.id, Bound: bound}}
+	// the work queue is sized to hold a full round, so none of these sends block
+	jobs := 0
+	for ; jobs < g.workQueueSize; jobs++ {
+		best, ok := g.edgeSet.best(int(bound))
+		if !ok {
+			break
+		}
+		g.outstandingJobs.Add(1)
+		g.processed.Add(1)
+		g.workQueue <- job{index: jobs, board: best}
+		// iff the drawing queue is waiting, have it draw the best board of the round
+		if jobs == 0 {
+			select {
+			case drawingQueue <- best:
+			default:
+			}
+		}
+		g.edgeSet.pop()
+	}
+	if jobs == 0 {
+		close(g.workQueue)
+		return roundResult{finished: true}, nil
+	}
+	results := make([]jobResult, jobs)
+	for received := 0; received < jobs; received++ {
+		select {
+		case <-ctx.Done():
+			return roundResult{}, fmt.Errorf("context expired on group %d during round: %w", g.id, ctx.Err())
+		case jobResult := <-g.resultQueue:
+			results[jobResult.index] = jobResult
+		}
+	}
+	var newBoards int
+	dedup := newTraceHash()
+	for _, expansion := range results {
+		for k, expandedBoard := range expansion.expanded {
+			marked := g.markExpanded(expandedBoard)
+			if marked {
+				g.adopt(expandedBoard, expansion.expandedParent(k))
+			}
+			dedup = dedup.add(expandedBoard, marked)
+		}
+		for i, newBoard := range expansion.boards {
+			if newBoard.IsSolved {
+				result.solutions = append(result.solutions, newBoard)
+				continue
+			}
+			inserted := g.insertBoard(newBoard)
+			dedup = dedup.add(newBoard, inserted)
+			if inserted {
+				g.adopt(newBoard, expansion.parentOf(i))
+				result.event.Inserted++
+			} else {
+				result.event.Duplicates++
+			}
+		}
+		g.merged(&expansion)
+		newBoards += len(expansion.boards)
+	}
+	var err error
+	result.event.Evicted, err = g.settleEdgeSet(newBoards)
+	if err != nil {
+		return roundResult{}, fmt.Errorf("failed to settle edge set of group %d: %w", g.id, err)
+	}
+	result.event.Jobs = jobs
+	result.event.Dedup = dedup.String()
+	return result, nil
+}
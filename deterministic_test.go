@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/AlexTGMM/chess-coverage-search/chess"
+	"slices"
+	"testing"
+	"time"
+)
+
+// limitedTracer cuts a deterministic run short after limit events, the same way a replay stops when it catches
+// up with an interrupted trace.  The events are kept, and passed on to inner if it isn't nil
+type limitedTracer struct {
+	inner  tracer
+	limit  int
+	events []traceEvent
+}
+
+func (l *limitedTracer) record(event traceEvent) error {
+	// the end of the run is still passed on, so a recorded trace shows it was cut short
+	if event.Type != "end" && len(l.events) >= l.limit {
+		return errTraceEnded
+	}
+	l.events = append(l.events, event)
+	if l.inner == nil {
+		return nil
+	}
+	return l.inner.record(event)
+}
+
+func (l *limitedTracer) close() error {
+	return nil
+}
+
+// setDeterministic sets up the flags for a short deterministic run.  Plunging finds solutions within the first
+// few rounds, and two partitions check that groups are merged in a fixed order
+func setDeterministic(t *testing.T) {
+	previousDeterministic, previousStrategy, previousPartitions, previousSeed := *deterministic, *strategy, *partitions, *seed
+	previousHeuristic := heuristic
+	t.Cleanup(func() {
+		*deterministic, *strategy, *partitions, *seed = previousDeterministic, previousStrategy, previousPartitions, previousSeed
+		heuristic = previousHeuristic
+		trace = nil
+	})
+	*deterministic, *strategy, *partitions, *seed = true, "plunge", 2, 7
+	heuristic = eachBoard(defaultHeuristic)
+}
+
+// runTraced runs a deterministic search over 3 cores from bound until limit events have been recorded, and
+// returns them
+func runTraced(t *testing.T, inner tracer, bound int32, limit int) []traceEvent {
+	limited := &limitedTracer{inner: inner, limit: limit}
+	trace = limited
+	defer func() { trace = nil }()
+	solver, err := NewSolver(3)
+	if err != nil {
+		t.Fatalf("failed to create solver: %v", err)
+	}
+	currBestScore.Store(bound)
+	err = solver.Run(context.Background())
+	if err != nil {
+		t.Fatalf("failed to run solver: %v", err)
+	}
+	return limited.events
+}
+
+// two runs with the same seed must produce the same rounds and solutions
+func TestDeterministicCoordinator_repeatable(t *testing.T) {
+	setDeterministic(t)
+	// a generous bound, so the first dives already end in solutions
+	first := runTraced(t, nil, 48, 150)
+	second := runTraced(t, nil, 48, 150)
+	if len(first) != 151 || first[150].Type != "end" || !first[150].Truncated {
+		t.Fatalf("expected the run to be cut short after 150 events, got %d", len(first))
+	}
+	groups := map[int]bool{}
+	solutions := 0
+	for _, event := range first {
+		switch event.Type {
+		case "round":
+			groups[event.Group] = true
+		case "solution":
+			solutions++
+		}
+	}
+	if len(groups) != 2 || solutions == 0 || first[149].Round == 0 {
+		t.Fatalf("expected several rounds from both groups and some solutions, got %d solutions", solutions)
+	}
+	if !slices.Equal(first, second) {
+		for i := range first {
+			if i >= len(second) || first[i] != second[i] {
+				t.Fatalf("runs diverged at event %d:\n\t%+v\n\t%+v", i, first[i], second[min(i, len(second)-1)])
+			}
+		}
+		t.Fatalf("expected %d events, got %d", len(first), len(second))
+	}
+}
+
+// a group that runs out of boards in the same round the deadline hits must not have its work queue closed twice
+func TestDeterministicCoordinator_deadline(t *testing.T) {
+	currBestScore.Store(INITIAL_BEST_SCORE)
+	empty, err := newGroup(0, 1, nil)
+	if err != nil {
+		t.Fatalf("failed to create group: %v", err)
+	}
+	// nothing works this group's jobs, so its round is still waiting when the deadline hits
+	stalled, err := newGroup(1, 1, []chess.MinimalBoard{{}})
+	if err != nil {
+		t.Fatalf("failed to create group: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = makeDeterministicCoordinator(ctx, []*group{empty, stalled}, make(chan chess.MinimalBoard))()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the coordinator to stop at the deadline, got %v", err)
+	}
+	for _, g := range []*group{empty, stalled} {
+		if _, ok := <-g.workQueue; ok {
+			// drain the stalled job
+			if _, ok = <-g.workQueue; ok {
+				t.Errorf("expected group %d's work queue to be closed", g.id)
+			}
+		}
+	}
+}
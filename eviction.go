@@ -0,0 +1,296 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/AlexTGMM/chess-coverage-search/chess"
+)
+
+// command line flags to control the memory used by the groups
+var maxFrontier = flag.Int("max-frontier", 0, "cap how many boards each group keeps track of, dropping boards that have been searched and then forgetting the worst waiting boards once it's over, 0 for no limit")
+
+// EVICTION_SLACK_DIVISOR a group over the limit is cut back to this fraction of the limit below it, so the
+// cost of finding the worst boards is spread over many insertions
+const EVICTION_SLACK_DIVISOR = 8
+
+// evictionTarget how many boards a group over the limit is cut back to
+func evictionTarget() int {
+	return *maxFrontier - *maxFrontier/EVICTION_SLACK_DIVISOR
+}
+
+// lineage where a board came from, and how much of the search still depends on it.  A board is held by every
+// copy of it waiting in the edge set or being expanded, and by every child that is still held itself.  Once
+// nothing holds it, its lineage is dropped, and it's only kept in the seen set to recognize duplicates for as
+// long as there's room under the limit
+type lineage struct {
+	// the board this one was first proposed from.  Roots have no parent
+	parent    chess.BoardKey
+	hasParent bool
+	holds     int
+}
+
+// evict brings a group over -max-frontier back under it, in the style of SMA*.  Boards that have been searched
+// are dropped from the seen set first, which only costs searching them again if they're proposed again.  If
+// that isn't enough, the worst waiting boards are forgotten.  A forgotten board is also dropped from the seen
+// set, and its parent goes back into the edge set carrying the best heuristic and the lowest score of its
+// forgotten children, so the parent is expanded again, and the children regenerated, once they would have been
+// the best choice, and it's only pruned once all of them could be.  Nothing under the bound is lost, only
+// searched again, so a bounded run is still complete.  Returns how many boards were forgotten
+func (g *group) evict() (int, error) {
+	if *maxFrontier <= 0 {
+		return 0, nil
+	}
+	g.sweepRegenerating()
+	forgotten := 0
+	for {
+		// forgetting boards can finish their ancestors, so this goes again after every batch
+		if len(g.lineage)+g.finished > *maxFrontier {
+			err := g.dropFinished(len(g.lineage) + g.finished - evictionTarget())
+			if err != nil {
+				return forgotten, err
+			}
+		}
+		if len(g.lineage) <= *maxFrontier {
+			return forgotten, nil
+		}
+		// the parents going back in can keep the group over the limit, in which case they're next in line
+		batch, err := g.evictBatch()
+		if err != nil {
+			return forgotten, err
+		}
+		// only roots, and the boards being expanded, are left, and they have to stay
+		if batch == 0 {
+			return forgotten, nil
+		}
+		forgotten += batch
+	}
+}
+
+// sweepRegenerating drops the parents whose backed up score is now over the bound.  The edge set discards them
+// rather than handing them out, so they'd never be regenerated, and their children can all be pruned anyway
+func (g *group) sweepRegenerating() {
+	bound := currBestScore.Load()
+	if bound >= g.regeneratedBound {
+		return
+	}
+	g.regeneratedBound = bound
+	for key, score := range g.regenerating {
+		if score > int(bound) {
+			delete(g.regenerating, key)
+		}
+	}
+}
+
+// evictBatch forgets enough of the worst boards to bring the group back under the limit, before their
+// parents are pushed back in
+func (g *group) evictBatch() (int, error) {
+	target := evictionTarget()
+	bound := int(currBestScore.Load())
+	forgotten := 0
+	// parents in the order they were first needed, so deterministic runs push them in a fixed order, each
+	// carrying the best heuristic and lowest score of its forgotten children
+	var order []chess.BoardKey
+	backedUp := map[chess.BoardKey]chess.MinimalBoard{}
+	// roots can't be forgotten, since nothing could regenerate them.  They're held back until the end, and don't
+	// count towards the target, so the best of the other boards always survive to be expanded rather than being
+	// forgotten and regenerated over and over when there are more roots than the limit
+	var kept []chess.MinimalBoard
+	// forgetting a board only frees it, and the ancestors only it was holding, if nothing else holds it
+	for excess := len(g.lineage) - len(kept) - target; excess > 0 && g.edgeSet.len() > 0; excess = len(g.lineage) - len(kept) - target {
+		for _, board := range g.edgeSet.evict(excess) {
+			key := board.Key()
+			entry := g.lineage[key]
+			if !entry.hasParent {
+				kept = append(kept, board)
+				continue
+			}
+			// a parent waiting to be regenerated is forgotten like any other board, and backed up into its own
+			// parent in turn
+			delete(g.regenerating, key)
+			g.forget(key)
+			forgotten++
+			// a board over the bound would be pruned rather than expanded, so there's nothing to regenerate
+			if board.Score > bound {
+				g.release(key)
+				continue
+			}
+			backed, ok := backedUp[entry.parent]
+			if !ok {
+				// the parent has to outlive its forgotten children until it goes back in
+				g.hold(entry.parent)
+				order = append(order, entry.parent)
+				backed.Heuristic = board.Heuristic
+				backed.Score = board.Score
+			}
+			backed.Heuristic = max(backed.Heuristic, board.Heuristic)
+			backed.Score = min(backed.Score, board.Score)
+			backedUp[entry.parent] = backed
+			g.release(key)
+		}
+	}
+	for _, board := range kept {
+		g.edgeSet.push(board)
+	}
+	pushed := len(kept)
+	for _, parentKey := range order {
+		backed := backedUp[parentKey]
+		// a parent that is already waiting will regenerate these children too, as long as it can't be pruned
+		// before they could.  SMA* would lower its backed up score instead, but the edge sets can't reorder a
+		// board in place, so otherwise it goes in again with the lower score
+		if score, ok := g.regenerating[parentKey]; ok && score <= backed.Score {
+			g.release(parentKey)
+			continue
+		}
+		parent, err := parentKey.Rebuild()
+		if err != nil {
+			return forgotten, fmt.Errorf("failed to rebuild parent of forgotten boards: %w", err)
+		}
+		parent.Heuristic = backed.Heuristic
+		parent.Score = backed.Score
+		g.regenerating[parentKey] = backed.Score
+		// the parent may have been forgotten itself.  It's back in the edge set, so it counts as seen again, and
+		// the hold taken for it above is now this copy's
+		if !g.seenBoards.Contains(parent) {
+			g.seenBoards.Put(parent)
+			g.seenCount.Add(1)
+		}
+		g.edgeSet.push(parent)
+		pushed++
+	}
+	g.edgeSet.settle(pushed, int32(bound))
+	g.evicted.Add(int64(forgotten))
+	return forgotten, nil
+}
+
+// adopt records the parent of a board that was just added to the seen set, so it can be regenerated if it's
+// ever forgotten, and holds the parent for as long as the board is held.  A forgotten board can be proposed
+// again by one of its own descendants while it's still held, so only its first parent is kept, or the links
+// could loop.  A board that is no longer held has no descendants left to loop through, and starts afresh
+func (g *group) adopt(board, parent chess.MinimalBoard) {
+	if g.lineage == nil {
+		return
+	}
+	key := board.Key()
+	entry := g.lineage[key]
+	if entry.hasParent {
+		return
+	}
+	entry.parent = parent.Key()
+	entry.hasParent = true
+	g.lineage[key] = entry
+	g.hold(entry.parent)
+}
+
+// hold takes a hold on a board, adding it to the lineage if it's new.  Returns whether the board had been
+// searched already, and was only still in the seen set to recognize duplicates
+func (g *group) hold(key chess.BoardKey) bool {
+	if g.lineage == nil {
+		return false
+	}
+	entry, ok := g.lineage[key]
+	entry.holds++
+	g.lineage[key] = entry
+	if _, seen := g.seenBoards[key]; !ok && seen {
+		g.finished--
+		return true
+	}
+	return false
+}
+
+// release gives up a hold on a board.  A board that is no longer held has been searched, so its lineage is
+// dropped, and it releases its own parent in turn
+func (g *group) release(key chess.BoardKey) {
+	for g.lineage != nil {
+		entry, ok := g.lineage[key]
+		if !ok {
+			return
+		}
+		entry.holds--
+		if entry.holds > 0 {
+			g.lineage[key] = entry
+			return
+		}
+		delete(g.lineage, key)
+		delete(g.regenerating, key)
+		if _, ok := g.seenBoards[key]; ok {
+			g.finished++
+			g.finishedOrder = append(g.finishedOrder, key)
+		}
+		if !entry.hasParent {
+			return
+		}
+		key = entry.parent
+	}
+}
+
+// forget drops a board from the seen set, so it can be proposed again
+func (g *group) forget(key chess.BoardKey) {
+	if _, ok := g.seenBoards[key]; ok {
+		delete(g.seenBoards, key)
+		g.seenCount.Add(-1)
+	}
+}
+
+// dropFinished drops at least count of the boards that have been searched from the seen set, if there are
+// that many.  Boards over the bound would only be discarded if they were proposed again, so they're no use for
+// recognizing duplicates, and are all dropped first.  After that, the boards that have been searched the
+// longest go first
+func (g *group) dropFinished(count int) error {
+	bound := currBestScore.Load()
+	if bound < g.finishedBound {
+		g.finishedBound = bound
+		kept := g.finishedOrder[:0]
+		for _, key := range g.finishedOrder {
+			score, err := key.Score()
+			if err != nil {
+				return fmt.Errorf("failed to score finished board: %w", err)
+			}
+			if score <= int(bound) {
+				kept = append(kept, key)
+			} else if g.dropIfFinished(key) {
+				count--
+			}
+		}
+		g.finishedOrder = kept
+	}
+	for count > 0 && len(g.finishedOrder) > 0 {
+		key := g.finishedOrder[0]
+		g.finishedOrder = g.finishedOrder[1:]
+		if g.dropIfFinished(key) {
+			count--
+		}
+	}
+	return nil
+}
+
+// dropIfFinished drops a board from the seen set, unless it was held again since it finished, or has already
+// been dropped.  Returns whether it was dropped
+func (g *group) dropIfFinished(key chess.BoardKey) bool {
+	if _, ok := g.lineage[key]; ok {
+		return false
+	}
+	if _, ok := g.seenBoards[key]; !ok {
+		return false
+	}
+	g.forget(key)
+	g.finished--
+	return true
+}
+
+// discarded is called by the edge set with every board it discards for being over the bound, which releases
+// the board's copy
+func (g *group) discarded(board chess.MinimalBoard) {
+	g.release(board.Key())
+}
+
+// merged is called with the result of every job once it has been merged.  If the board was a parent waiting
+// to be regenerated, it has been now.  Its children are regenerated from its pieces, so the backed up heuristic
+// and score it was expanded with don't matter.  The job's board, and the boards the worker expanded along the
+// way, are released, so they're only still held if some of their children are
+func (g *group) merged(result *jobResult) {
+	delete(g.regenerating, result.board.Key())
+	for _, board := range result.expanded {
+		g.release(board.Key())
+	}
+	g.release(result.board.Key())
+}
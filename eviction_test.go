@@ -0,0 +1,265 @@
+package main
+
+import (
+	"github.com/AlexTGMM/chess-coverage-search/chess"
+	"sort"
+	"testing"
+)
+
+// proposeSorted proposes the children of a board, best first
+func proposeSorted(t *testing.T, minimalBoard chess.MinimalBoard) []chess.MinimalBoard {
+	board, err := minimalBoard.RebuildBoard()
+	if err != nil {
+		t.Fatalf("failed to rebuild board: %v", err)
+	}
+	proposed, err := board.ProposeBoards(eachBoard(defaultHeuristic), INITIAL_BEST_SCORE)
+	if err != nil {
+		t.Fatalf("failed to propose boards: %v", err)
+	}
+	var result []chess.MinimalBoard
+	for proposedBoard := range proposed {
+		result = append(result, proposedBoard)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return worseBoard(result[j], result[i])
+	})
+	return result
+}
+
+// mergeExpansion merges the children of a board taken from the edge set, the way an orchestrator would, and
+// returns how many boards were forgotten
+func mergeExpansion(t *testing.T, g *group, board chess.MinimalBoard, children []chess.MinimalBoard) int {
+	result := jobResult{board: board, boards: children}
+	for i, child := range result.boards {
+		if g.insertBoard(child) {
+			g.adopt(child, result.parentOf(i))
+		}
+	}
+	g.merged(&result)
+	forgotten, err := g.settleEdgeSet(len(children))
+	if err != nil {
+		t.Fatalf("failed to settle edge set: %v", err)
+	}
+	return forgotten
+}
+
+// drainExpanded expands every board left in the edge set without finding any children, and checks that the
+// group has let go of everything once nothing is left to search
+func drainExpanded(t *testing.T, g *group, bound int) {
+	for {
+		board, ok := g.edgeSet.best(bound)
+		if !ok {
+			break
+		}
+		g.edgeSet.pop()
+		g.merged(&jobResult{board: board})
+	}
+	if len(g.lineage) != 0 || len(g.regenerating) != 0 || g.finished != len(g.seenBoards) {
+		t.Errorf("expected a finished search to hold nothing, but %d boards are held, %d are waiting to "+
+			"regenerate, and only %d of %d seen boards are finished", len(g.lineage), len(g.regenerating),
+			g.finished, len(g.seenBoards))
+	}
+	// the seen set is only kept to recognize duplicates, and can all be dropped
+	err := g.dropFinished(g.finished)
+	if err != nil {
+		t.Fatalf("failed to drop finished boards: %v", err)
+	}
+	if len(g.seenBoards) != 0 || g.seenCount.Load() != 0 {
+		t.Errorf("expected the seen set to be emptied, but %d boards are left", len(g.seenBoards))
+	}
+}
+
+func TestGroup_evict(t *testing.T) {
+	defer func() { *maxFrontier = 0 }()
+	*maxFrontier = 4
+	currBestScore.Store(INITIAL_BEST_SCORE)
+	root := chess.MinimalBoard{}
+	g, err := newGroup(0, 1, []chess.MinimalBoard{root})
+	if err != nil {
+		t.Fatalf("failed to create group: %v", err)
+	}
+	// expand the root, then its best child
+	g.edgeSet.pop()
+	parent := proposeSorted(t, root)[0]
+	mergeExpansion(t, g, root, []chess.MinimalBoard{parent})
+	g.edgeSet.pop()
+	children := proposeSorted(t, parent)
+	forgotten := mergeExpansion(t, g, parent, children)
+	// the root and the parent are held by the children that survive, and count against the limit too
+	if forgotten == 0 || len(g.lineage) > *maxFrontier {
+		t.Fatalf("expected the group to be cut back to %d boards, but %d boards were forgotten and %d are held",
+			*maxFrontier, forgotten, len(g.lineage))
+	}
+	if !g.seenBoards.Contains(children[0]) {
+		t.Errorf("expected the best child to survive eviction")
+	}
+	// every forgotten board must be dropped from the seen set and the lineage, and its parent must be waiting to
+	// regenerate it, carrying the best of what was forgotten
+	var waiting []chess.MinimalBoard
+	var backed chess.MinimalBoard
+	for g.edgeSet.len() > 0 {
+		board, _ := g.edgeSet.best(INITIAL_BEST_SCORE)
+		g.edgeSet.pop()
+		waiting = append(waiting, board)
+		if board.Key() == parent.Key() {
+			backed = board
+		}
+	}
+	if backed.Key() != parent.Key() {
+		t.Fatalf("expected the parent to be waiting to regenerate its forgotten children")
+	}
+	for _, child := range children {
+		if g.seenBoards.Contains(child) {
+			continue
+		}
+		if _, ok := g.lineage[child.Key()]; ok {
+			t.Errorf("expected forgotten board %v to be dropped from the lineage", child)
+		}
+		if backed.Score > child.Score || backed.Heuristic < child.Heuristic {
+			t.Errorf("expected the parent to carry forgotten board %v, got score %d and heuristic %f",
+				child, backed.Score, backed.Heuristic)
+		}
+	}
+	for _, board := range waiting {
+		g.merged(&jobResult{board: board})
+	}
+	// parents waiting to be regenerated stop waiting once they've been expanded, and once everything is expanded,
+	// the whole lineage is dropped, roots and all
+	drainExpanded(t, g, INITIAL_BEST_SCORE)
+}
+
+func TestGroup_evictUnderBound(t *testing.T) {
+	defer func() {
+		*maxFrontier = 0
+		currBestScore.Store(INITIAL_BEST_SCORE)
+	}()
+	*maxFrontier = 4
+	currBestScore.Store(INITIAL_BEST_SCORE)
+	// find a board with a child that reduces to a lower score, and isn't so good it would survive eviction
+	var parent, child chess.MinimalBoard
+	var children []chess.MinimalBoard
+search:
+	for _, placement := range proposeSorted(t, chess.MinimalBoard{}) {
+		for _, candidate := range proposeSorted(t, placement) {
+			children = proposeSorted(t, candidate)
+			for i, proposed := range children {
+				if i >= *maxFrontier && proposed.Score < candidate.Score {
+					parent, child = candidate, proposed
+					break search
+				}
+			}
+		}
+	}
+	if child.Score == 0 {
+		t.Fatalf("expected to find a child that scores lower than its parent")
+	}
+	// the parent is the only root, so nothing above it can regenerate the child in its place
+	g, err := newGroup(0, 1, []chess.MinimalBoard{parent})
+	if err != nil {
+		t.Fatalf("failed to create group: %v", err)
+	}
+	g.edgeSet.pop()
+	mergeExpansion(t, g, parent, children)
+	if g.seenBoards.Contains(child) {
+		t.Fatalf("expected %v to be forgotten", child)
+	}
+	// a bound between the two scores prunes the parent, but not the child it has to regenerate
+	bound := child.Score
+	currBestScore.Store(int32(bound))
+	_, err = g.settleEdgeSet(0)
+	if err != nil {
+		t.Fatalf("failed to settle edge set: %v", err)
+	}
+	regenerates := false
+	for g.edgeSet.len() > 0 {
+		board, ok := g.edgeSet.best(bound)
+		if !ok {
+			break
+		}
+		if board.Key() == parent.Key() {
+			regenerates = true
+			if board.Score > bound {
+				t.Errorf("expected the parent to carry its forgotten child's score %d, got %d", bound, board.Score)
+			}
+			break
+		}
+		g.edgeSet.pop()
+		g.merged(&jobResult{board: board})
+	}
+	if !regenerates {
+		t.Fatalf("forgotten board %v was pruned along with its parent", child)
+	}
+	// once the bound falls below everything forgotten, nothing is left waiting to be regenerated, and the
+	// boards the edge set discards are let go
+	currBestScore.Store(0)
+	_, err = g.settleEdgeSet(0)
+	if err != nil {
+		t.Fatalf("failed to settle edge set: %v", err)
+	}
+	if len(g.regenerating) != 0 {
+		t.Errorf("expected parents pruned by the bound to stop waiting, but %d are left", len(g.regenerating))
+	}
+	drainExpanded(t, g, 0)
+}
+
+func TestGroup_dropFinished(t *testing.T) {
+	defer func() {
+		*maxFrontier = 0
+		currBestScore.Store(INITIAL_BEST_SCORE)
+	}()
+	*maxFrontier = 1000
+	currBestScore.Store(INITIAL_BEST_SCORE)
+	g, err := newGroup(0, 1, proposeSorted(t, chess.MinimalBoard{}))
+	if err != nil {
+		t.Fatalf("failed to create group: %v", err)
+	}
+	// search every root without finding anything, so they finish in the order they're expanded
+	var order []chess.MinimalBoard
+	for {
+		board, ok := g.edgeSet.best(INITIAL_BEST_SCORE)
+		if !ok {
+			break
+		}
+		g.edgeSet.pop()
+		g.merged(&jobResult{board: board})
+		order = append(order, board)
+	}
+	if g.finished != len(order) || len(g.seenBoards) != len(order) {
+		t.Fatalf("expected all %d roots to be finished and still seen, got %d finished and %d seen", len(order),
+			g.finished, len(g.seenBoards))
+	}
+	bound := order[0].Score
+	for _, board := range order {
+		bound = min(bound, board.Score)
+	}
+	currBestScore.Store(int32(bound))
+	// boards over the bound are all dropped, however few were asked for
+	err = g.dropFinished(1)
+	if err != nil {
+		t.Fatalf("failed to drop finished boards: %v", err)
+	}
+	var under []chess.MinimalBoard
+	for _, board := range order {
+		if board.Score <= bound {
+			under = append(under, board)
+		}
+		if g.seenBoards.Contains(board) != (board.Score <= bound) {
+			t.Errorf("expected only boards over the bound %d to be dropped, got %v", bound, board)
+		}
+	}
+	if len(under) < 2 || len(under) == len(order) {
+		t.Fatalf("expected a mix of boards over and under the bound %d", bound)
+	}
+	// after that, the boards that finished first go first
+	err = g.dropFinished(1)
+	if err != nil {
+		t.Fatalf("failed to drop finished boards: %v", err)
+	}
+	if g.seenBoards.Contains(under[0]) || !g.seenBoards.Contains(under[1]) {
+		t.Errorf("expected only the first board to finish to be dropped")
+	}
+	if g.finished != len(under)-1 || g.seenCount.Load() != int64(len(under)-1) {
+		t.Errorf("expected %d finished boards left, got %d finished and %d seen", len(under)-1, g.finished,
+			g.seenCount.Load())
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/AlexTGMM/chess-coverage-search/chess"
+	"math"
+	"slices"
+	"sort"
+)
+
+// command line flags to control the frontier
+var frontierKind = flag.String("frontier", "sorted", "edge set implementation, either sorted or bucket")
+var bucketResolution = flag.Float64("bucket-resolution", 16, "buckets per unit of heuristic for the bucket frontier")
+
+// frontier is the edge set of boards waiting to be expanded, best first
+type frontier interface {
+	// push adds a board to the frontier
+	push(board chess.MinimalBoard)
+	// best returns the best board with a score within bound, without removing it.  Any better boards
+	// with a score over the bound are discarded along the way, and handed to the frontier's discard function
+	best(bound int) (chess.MinimalBoard, bool)
+	// pop removes the board last returned by best
+	pop()
+	// settle is called after every batch of pushes, with the number of boards pushed and the current bound
+	settle(pushed int, bound int32)
+	// evict removes and returns the count worst boards
+	evict(count int) []chess.MinimalBoard
+	len() int
+}
+
+// newFrontier creates the frontier selected by -frontier.  lookahead is how many boards are likely to be
+// taken from the frontier between calls to settle.  discard, if not nil, is called with every board the
+// frontier discards for being over the bound
+func newFrontier(lookahead int, discard func(chess.MinimalBoard)) (frontier, error) {
+	switch *frontierKind {
+	case "sorted":
+		return &sortedFrontier{lookahead: lookahead, sortedBound: math.MaxInt32, discard: discard}, nil
+	case "bucket":
+		if *bucketResolution <= 0 {
+			return nil, fmt.Errorf("bucket resolution must be positive, got %f", *bucketResolution)
+		}
+		return &bucketFrontier{resolution: float32(*bucketResolution), discard: discard}, nil
+	default:
+		return nil, fmt.Errorf("unknown frontier %q, expected sorted or bucket", *frontierKind)
+	}
+}
+
+// sortedFrontier a slice kept sorted from worst to best, so the best board is at the tail.  Sorting
+// everything after every batch is far too slow, so only the tail that may be used before the next batch
+// arrives is sorted
+type sortedFrontier struct {
+	boards    []chess.MinimalBoard
+	lookahead int
+	// the bound the boards were last fully sorted under
+	sortedBound int32
+	discard     func(chess.MinimalBoard)
+}
+
+func (s *sortedFrontier) push(board chess.MinimalBoard) {
+	s.boards = append(s.boards, board)
+}
+
+func (s *sortedFrontier) best(bound int) (chess.MinimalBoard, bool) {
+	// discard best boards until the best board has an acceptable score
+	tailIndex := len(s.boards) - 1
+	for tailIndex >= 0 && s.boards[tailIndex].Score > bound {
+		if s.discard != nil {
+			s.discard(s.boards[tailIndex])
+		}
+		s.boards = s.boards[:tailIndex]
+		tailIndex--
+	}
+	if tailIndex < 0 {
+		return chess.MinimalBoard{}, false
+	}
+	return s.boards[tailIndex], true
+}
+
+func (s *sortedFrontier) pop() {
+	s.boards = s.boards[:len(s.boards)-1]
+}
+
+// settle only sorts the boards we may plan to use, unless the score has changed.  If
+// the score has changed, sort them all since we don't know how many may get discarded
+// TODO: might it be better to actually discard the boards that are no long in bounds,
+// and still only sort the tip of the edge set?  Probably.  Try this next
+func (s *sortedFrontier) settle(pushed int, bound int32) {
+	offset := len(s.boards) - (pushed + s.lookahead)
+	// the bound is shared between groups, so another group may have lowered it at any time
+	if offset < 0 || bound != s.sortedBound {
+		offset = 0
+		s.sortedBound = bound
+	}
+	sort.Slice(s.boards[offset:], func(i, j int) bool {
+		return worseBoard(s.boards[offset+i], s.boards[offset+j])
+	})
+}
+
+// evict has to sort everything, since only the tail is normally kept in order
+func (s *sortedFrontier) evict(count int) []chess.MinimalBoard {
+	sort.Slice(s.boards, func(i, j int) bool {
+		return worseBoard(s.boards[i], s.boards[j])
+	})
+	count = min(count, len(s.boards))
+	evicted := slices.Clone(s.boards[:count])
+	s.boards = slices.Delete(s.boards, 0, count)
+	return evicted
+}
+
+func (s *sortedFrontier) len() int {
+	return len(s.boards)
+}
+
+// bucketFrontier a bucket queue over quantized heuristics.  The default heuristic is built from small
+// integer quantities, so quantizing it loses very little, and in exchange push and pop are O(1) instead of
+// paying for a sort.  Boards within a bucket come out last in first out, and never need sorting
+type bucketFrontier struct {
+	buckets    [][]chess.MinimalBoard
+	resolution float32
+	// the highest bucket that may be non-empty
+	top     int
+	count   int
+	discard func(chess.MinimalBoard)
+}
+
+// MAX_BUCKETS caps how many buckets the bucket frontier will allocate.  Learned and remote heuristics can
+// return any float, and one huge value must not allocate billions of empty buckets
+const MAX_BUCKETS = 1 << 16
+
+// bucket quantizes a heuristic.  Anything below zero, or NaN, shares the lowest bucket, and anything past
+// MAX_BUCKETS shares the highest
+func (b *bucketFrontier) bucket(heuristic float32) int {
+	scaled := float64(heuristic) * float64(b.resolution)
+	// written so NaN fails the comparison too
+	if !(scaled > 0) {
+		return 0
+	}
+	if scaled >= MAX_BUCKETS-1 {
+		return MAX_BUCKETS - 1
+	}
+	return int(scaled)
+}
+
+func (b *bucketFrontier) push(board chess.MinimalBoard) {
+	index := b.bucket(board.Heuristic)
+	if index >= len(b.buckets) {
+		b.buckets = append(b.buckets, make([][]chess.MinimalBoard, index-len(b.buckets)+1)...)
+	}
+	b.buckets[index] = append(b.buckets[index], board)
+	b.top = max(b.top, index)
+	b.count++
+}
+
+func (b *bucketFrontier) best(bound int) (chess.MinimalBoard, bool) {
+	for ; b.top >= 0 && b.count > 0; b.top-- {
+		bucket := b.buckets[b.top]
+		// discard best boards until the best board has an acceptable score
+		for len(bucket) > 0 && bucket[len(bucket)-1].Score > bound {
+			if b.discard != nil {
+				b.discard(bucket[len(bucket)-1])
+			}
+			bucket = bucket[:len(bucket)-1]
+			b.count--
+		}
+		b.buckets[b.top] = bucket
+		if len(bucket) > 0 {
+			return bucket[len(bucket)-1], true
+		}
+	}
+	b.top = 0
+	return chess.MinimalBoard{}, false
+}
+
+func (b *bucketFrontier) pop() {
+	bucket := b.buckets[b.top]
+	b.buckets[b.top] = bucket[:len(bucket)-1]
+	b.count--
+}
+
+// settle has nothing to do, since buckets never need sorting
+func (b *bucketFrontier) settle(int, int32) {}
+
+// evict takes from the lowest buckets first, and the oldest boards within each bucket
+func (b *bucketFrontier) evict(count int) []chess.MinimalBoard {
+	evicted := make([]chess.MinimalBoard, 0, min(count, b.count))
+	for i := 0; i < len(b.buckets) && len(evicted) < count; i++ {
+		taken := min(count-len(evicted), len(b.buckets[i]))
+		evicted = append(evicted, b.buckets[i][:taken]...)
+		b.buckets[i] = slices.Delete(b.buckets[i], 0, taken)
+		b.count -= taken
+	}
+	return evicted
+}
+
+func (b *bucketFrontier) len() int {
+	return b.count
+}
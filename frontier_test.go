@@ -0,0 +1,144 @@
+package main
+
+import (
+	"github.com/AlexTGMM/chess-coverage-search/chess"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// makeTestBoard a board with only the fields the frontiers care about
+func makeTestBoard(coverage, score int) chess.MinimalBoard {
+	return chess.MinimalBoard{
+		Heuristic: (float32(coverage) / float32(score)) + float32(coverage),
+		Score:     score,
+		Coverage:  coverage,
+	}
+}
+
+func TestFrontiers(t *testing.T) {
+	for _, kind := range []string{"sorted", "bucket"} {
+		t.Run(kind, func(t *testing.T) {
+			*frontierKind = kind
+			var discarded []chess.MinimalBoard
+			edgeSet, err := newFrontier(1, func(board chess.MinimalBoard) { discarded = append(discarded, board) })
+			if err != nil {
+				t.Fatalf("failed to create frontier: %v", err)
+			}
+			edgeSet.push(makeTestBoard(10, 5))
+			edgeSet.push(makeTestBoard(30, 20))
+			edgeSet.push(makeTestBoard(20, 10))
+			edgeSet.settle(3, 28)
+			if edgeSet.len() != 3 {
+				t.Errorf("expected 3 boards, got %d", edgeSet.len())
+			}
+			// the best board is over the bound, so it should be discarded
+			best, ok := edgeSet.best(15)
+			if !ok || best.Coverage != 20 {
+				t.Errorf("expected the board with coverage 20, got %v", best)
+			}
+			if len(discarded) != 1 || discarded[0].Coverage != 30 {
+				t.Errorf("expected the board with coverage 30 to be discarded, got %v", discarded)
+			}
+			edgeSet.pop()
+			best, ok = edgeSet.best(15)
+			if !ok || best.Coverage != 10 {
+				t.Errorf("expected the board with coverage 10, got %v", best)
+			}
+			edgeSet.pop()
+			if _, ok = edgeSet.best(15); ok || edgeSet.len() != 0 {
+				t.Errorf("expected an empty frontier, but %d boards are left", edgeSet.len())
+			}
+		})
+	}
+	*frontierKind = "sorted"
+}
+
+func TestFrontiers_evict(t *testing.T) {
+	for _, kind := range []string{"sorted", "bucket"} {
+		t.Run(kind, func(t *testing.T) {
+			*frontierKind = kind
+			edgeSet, err := newFrontier(1, nil)
+			if err != nil {
+				t.Fatalf("failed to create frontier: %v", err)
+			}
+			for coverage := 10; coverage <= 50; coverage += 10 {
+				edgeSet.push(makeTestBoard(coverage, 5))
+			}
+			edgeSet.settle(5, 28)
+			evicted := edgeSet.evict(2)
+			if len(evicted) != 2 || evicted[0].Coverage != 10 || evicted[1].Coverage != 20 {
+				t.Errorf("expected the two worst boards to be evicted, got %v", evicted)
+			}
+			if edgeSet.len() != 3 {
+				t.Errorf("expected 3 boards left, got %d", edgeSet.len())
+			}
+			best, ok := edgeSet.best(28)
+			if !ok || best.Coverage != 50 {
+				t.Errorf("expected the best board to survive eviction, got %v", best)
+			}
+			if evicted = edgeSet.evict(10); len(evicted) != 3 || edgeSet.len() != 0 {
+				t.Errorf("expected everything to be evicted, got %d boards and %d left", len(evicted), edgeSet.len())
+			}
+		})
+	}
+	*frontierKind = "sorted"
+}
+
+func TestBucketFrontier_extremeHeuristics(t *testing.T) {
+	edgeSet := &bucketFrontier{resolution: 16}
+	for _, heuristic := range []float64{1e8, math.Inf(1), math.Inf(-1), math.NaN(), -5, 3} {
+		board := makeTestBoard(10, 5)
+		board.Heuristic = float32(heuristic)
+		edgeSet.push(board)
+	}
+	if len(edgeSet.buckets) > MAX_BUCKETS {
+		t.Errorf("expected at most %d buckets, got %d", MAX_BUCKETS, len(edgeSet.buckets))
+	}
+	best, ok := edgeSet.best(INITIAL_BEST_SCORE)
+	if !ok || !math.IsInf(float64(best.Heuristic), 1) && best.Heuristic != 1e8 {
+		t.Errorf("expected one of the huge heuristics to be best, got %v", best)
+	}
+	for edgeSet.len() > 0 {
+		if _, ok := edgeSet.best(INITIAL_BEST_SCORE); !ok {
+			t.Fatalf("expected %d more boards", edgeSet.len())
+		}
+		edgeSet.pop()
+	}
+}
+
+// BenchmarkFrontiers mimics a large search where frontier operations dominate.  Each expansion pops the best
+// board and pushes a batch of children that cover a little more for a little more score, the same shape of
+// heuristic values the workers produce.  The children come from a fixed stream rather than from the board that
+// was popped, and the bound is loose enough that nothing is discarded, so every frontier does the same pushes
+// and pops and ends up the same size
+func BenchmarkFrontiers(b *testing.B) {
+	const lookahead = 8 * WORK_QUEUE_SIZE_FACTOR
+	const bound = 4 * INITIAL_BEST_SCORE
+	for _, kind := range []string{"sorted", "bucket"} {
+		b.Run(kind, func(b *testing.B) {
+			*frontierKind = kind
+			edgeSet, err := newFrontier(lookahead, nil)
+			if err != nil {
+				b.Fatalf("failed to create frontier: %v", err)
+			}
+			random := rand.New(rand.NewSource(1))
+			edgeSet.push(makeTestBoard(0, 1))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, ok := edgeSet.best(bound); ok {
+					edgeSet.pop()
+				}
+				children := 1 + random.Intn(3)
+				for j := 0; j < children; j++ {
+					depth := random.Intn(10)
+					coverage := min(depth*6+1+random.Intn(12), chess.BOARD_SIZE*chess.BOARD_SIZE-1)
+					edgeSet.push(makeTestBoard(coverage, depth*5+1+random.Intn(9)))
+				}
+				edgeSet.settle(children, bound)
+			}
+			b.ReportMetric(float64(edgeSet.len()), "boards")
+		})
+	}
+	*frontierKind = "sorted"
+}
@@ -2,4 +2,8 @@ module github.com/AlexTGMM/chess-coverage-search
 
 go 1.21.6
 
-require golang.org/x/sync v0.6.0
+require (
+	// only used by the onnx heuristic backend, which is built with -tags onnx
+	github.com/yalue/onnxruntime_go v1.36.0
+	golang.org/x/sync v0.6.0
+)
@@ -0,0 +1,11 @@
+//go:build !onnx
+
+package main
+
+import "fmt"
+
+func init() {
+	heuristicBackends["onnx"] = func(string) (heuristicFunc, func() error, error) {
+		return nil, nil, fmt.Errorf("onnx heuristic is not available in this build, rebuild with -tags onnx")
+	}
+}
@@ -0,0 +1,105 @@
+//go:build onnx
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/AlexTGMM/chess-coverage-search/chess"
+	ort "github.com/yalue/onnxruntime_go"
+	"sync"
+)
+
+// command line flags to control the onnx heuristic
+var onnxLibrary = flag.String("onnx-lib", "", "path to the onnxruntime shared library, if not on the default search path")
+var onnxInput = flag.String("onnx-input", "input", "name of the onnx model's feature input")
+var onnxOutput = flag.String("onnx-output", "output", "name of the onnx model's heuristic output")
+
+func init() {
+	heuristicBackends["onnx"] = newOnnxHeuristic
+}
+
+// onnxHeuristic evaluates an onnx model on a board's chess.FeatureVector.  The model must take a float32
+// tensor of shape [1, chess.FEATURE_COUNT] laid out as chess.FEATURE_VERSION, and produce a float32 tensor
+// of shape [1, 1]
+type onnxHeuristic struct {
+	// the session is bound to a single input and output tensor, so only one evaluation can run at a time
+	lock    sync.Mutex
+	session *ort.AdvancedSession
+	input   *ort.Tensor[float32]
+	output  *ort.Tensor[float32]
+}
+
+func newOnnxHeuristic(modelPath string) (heuristicFunc, func() error, error) {
+	if modelPath == "" {
+		return nil, nil, fmt.Errorf("onnx heuristic requires a model path: -heuristic=onnx:<path>")
+	}
+	if *onnxLibrary != "" {
+		ort.SetSharedLibraryPath(*onnxLibrary)
+	}
+	err := ort.InitializeEnvironment()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize onnxruntime: %w", err)
+	}
+	result := &onnxHeuristic{}
+	result.input, err = ort.NewEmptyTensor[float32](ort.NewShape(1, int64(chess.FEATURE_COUNT)))
+	if err != nil {
+		_ = result.close()
+		return nil, nil, fmt.Errorf("failed to create onnx input tensor: %w", err)
+	}
+	result.output, err = ort.NewEmptyTensor[float32](ort.NewShape(1, 1))
+	if err != nil {
+		_ = result.close()
+		return nil, nil, fmt.Errorf("failed to create onnx output tensor: %w", err)
+	}
+	result.session, err = ort.NewAdvancedSession(modelPath,
+		[]string{*onnxInput}, []string{*onnxOutput},
+		[]ort.ArbitraryTensor{result.input}, []ort.ArbitraryTensor{result.output}, nil)
+	if err != nil {
+		_ = result.close()
+		return nil, nil, fmt.Errorf("failed to load onnx model %s: %w", modelPath, err)
+	}
+	return eachBoard(result.evaluate), result.close, nil
+}
+
+func (o *onnxHeuristic) evaluate(board *chess.Board) (float32, error) {
+	features := board.Features()
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	copy(o.input.GetData(), features[:])
+	err := o.session.Run()
+	if err != nil {
+		return 0, fmt.Errorf("failed to run onnx model: %w", err)
+	}
+	return o.output.GetData()[0], nil
+}
+
+// close destroys whatever has been created so far, so it also cleans up after a partially constructed
+// heuristic.  Everything is destroyed even if something fails along the way
+func (o *onnxHeuristic) close() error {
+	var errs []error
+	if o.session != nil {
+		err := o.session.Destroy()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to destroy onnx session: %w", err))
+		}
+	}
+	if o.input != nil {
+		err := o.input.Destroy()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to destroy onnx input tensor: %w", err))
+		}
+	}
+	if o.output != nil {
+		err := o.output.Destroy()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to destroy onnx output tensor: %w", err))
+		}
+	}
+	err := ort.DestroyEnvironment()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to destroy onnxruntime environment: %w", err))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/AlexTGMM/chess-coverage-search/chess"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// command line flags to control the remote heuristic
+var remoteBatchSize = flag.Int("remote-batch", 256, "maximum number of boards sent to a remote heuristic in one request")
+var remoteLinger = flag.Duration("remote-linger", time.Millisecond, "how long to wait for a remote heuristic batch to fill before sending it")
+var remoteInflight = flag.Int("remote-inflight", 4, "maximum number of concurrent requests to a remote heuristic")
+var remoteCacheSize = flag.Int("remote-cache", 1<<20, "maximum number of remote heuristic results to cache")
+var remoteTimeout = flag.Duration("remote-timeout", 30*time.Second, "timeout for a single remote heuristic request")
+
+func init() {
+	heuristicBackends["http"] = func(arg string) (heuristicFunc, func() error, error) {
+		return newRemoteHeuristic("http:" + arg)
+	}
+	heuristicBackends["https"] = func(arg string) (heuristicFunc, func() error, error) {
+		return newRemoteHeuristic("https:" + arg)
+	}
+}
+
+// remoteBatchRequest the body POSTed to a remote heuristic
+type remoteBatchRequest struct {
+	Version  int                   `json:"version"`
+	Features []chess.FeatureVector `json:"features"`
+}
+
+// remoteBatchResponse the body expected back from a remote heuristic.  Values must line up with the features
+// in the request
+type remoteBatchResponse struct {
+	Values []float32 `json:"values"`
+}
+
+// remoteRequest the uncached boards of a single expansion waiting to be evaluated, by their features
+type remoteRequest struct {
+	features []chess.FeatureVector
+	reply    chan remoteReply
+}
+
+// remoteReply the values for a remoteRequest, in the same order as its features
+type remoteReply struct {
+	values []float32
+	err    error
+}
+
+// remoteHeuristic evaluates boards with an HTTP service, so heuristics can be written in whatever language
+// is convenient.  A worker blocks on the evaluation of everything it proposed, so every round trip costs a
+// worker the full request latency.  To make that affordable, all of an expansion's proposals are sent in a
+// single request, so a worker pays for one round trip per expansion rather than one per board.  Requests from
+// different workers are combined into batches, several batches can be in flight at once, and results are
+// cached by feature vector, since many distinct boards share the same features
+type remoteHeuristic struct {
+	url      string
+	client   *http.Client
+	requests chan remoteRequest
+	// a semaphore limiting the number of batches in flight
+	inflight chan struct{}
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	cacheLock sync.Mutex
+	cache     map[chess.FeatureVector]float32
+}
+
+func newRemoteHeuristic(url string) (heuristicFunc, func() error, error) {
+	if *remoteBatchSize < 1 || *remoteInflight < 1 {
+		return nil, nil, fmt.Errorf("remote heuristic batch size and inflight requests must be positive")
+	}
+	result := &remoteHeuristic{
+		url:      url,
+		client:   &http.Client{Timeout: *remoteTimeout},
+		requests: make(chan remoteRequest, *remoteBatchSize),
+		inflight: make(chan struct{}, *remoteInflight),
+		done:     make(chan struct{}),
+		cache:    make(map[chess.FeatureVector]float32),
+	}
+	result.wg.Add(1)
+	go result.batch()
+	return result.evaluate, result.close, nil
+}
+
+func (r *remoteHeuristic) evaluate(boards []*chess.Board) ([]float32, error) {
+	values := make([]float32, len(boards))
+	features := make([]chess.FeatureVector, len(boards))
+	for i, board := range boards {
+		features[i] = board.Features()
+	}
+	// proposals often share features, so each uncached feature vector is only asked about once
+	var uncached []chess.FeatureVector
+	waiting := map[chess.FeatureVector][]int{}
+	r.cacheLock.Lock()
+	for i := range boards {
+		value, ok := r.cache[features[i]]
+		if ok {
+			values[i] = value
+			continue
+		}
+		if _, ok := waiting[features[i]]; !ok {
+			uncached = append(uncached, features[i])
+		}
+		waiting[features[i]] = append(waiting[features[i]], i)
+	}
+	r.cacheLock.Unlock()
+	// a batch never holds more than -remote-batch boards, so a large expansion is sent as several requests,
+	// all of them in flight at once
+	var chunks [][]chess.FeatureVector
+	var replies []chan remoteReply
+	for start := 0; start < len(uncached); start += *remoteBatchSize {
+		chunk := uncached[start:min(start+*remoteBatchSize, len(uncached))]
+		reply := make(chan remoteReply, 1)
+		select {
+		case r.requests <- remoteRequest{features: chunk, reply: reply}:
+		case <-r.done:
+			return nil, fmt.Errorf("remote heuristic is closed")
+		}
+		chunks = append(chunks, chunk)
+		replies = append(replies, reply)
+	}
+	for i, reply := range replies {
+		// requests still queued when the heuristic closes are never answered, so don't wait on them
+		var result remoteReply
+		select {
+		case result = <-reply:
+		case <-r.done:
+			return nil, fmt.Errorf("remote heuristic is closed")
+		}
+		if result.err != nil {
+			return nil, result.err
+		}
+		r.cacheLock.Lock()
+		for k, chunkFeatures := range chunks[i] {
+			// the cache is only an optimization, so rather than tracking usage just start over when it fills up
+			if len(r.cache) >= *remoteCacheSize {
+				clear(r.cache)
+			}
+			r.cache[chunkFeatures] = result.values[k]
+			for _, index := range waiting[chunkFeatures] {
+				values[index] = result.values[k]
+			}
+		}
+		r.cacheLock.Unlock()
+	}
+	return values, nil
+}
+
+// batch collects requests into batches of up to -remote-batch boards and hands them off to be sent.  A batch
+// is sent once it is full, or the linger time has passed since its first request and a connection is free.
+// While every connection is busy, the pending batch keeps filling with other workers' requests, so batches
+// grow as latency grows.  A request that would overfill a batch starts the next one instead
+func (r *remoteHeuristic) batch() {
+	defer r.wg.Done()
+	var overflow []remoteRequest
+	for {
+		pending := overflow
+		overflow = nil
+		if len(pending) == 0 {
+			select {
+			case <-r.done:
+				return
+			case request := <-r.requests:
+				pending = append(pending, request)
+			}
+		}
+		size := len(pending[0].features)
+		// add takes a request into the pending batch, and reports if the batch can take any more
+		add := func(request remoteRequest) bool {
+			if size+len(request.features) > *remoteBatchSize {
+				overflow = append(overflow, request)
+				return false
+			}
+			pending = append(pending, request)
+			size += len(request.features)
+			return size < *remoteBatchSize
+		}
+		open := size < *remoteBatchSize
+		linger := time.NewTimer(*remoteLinger)
+	lingerLoop:
+		for open {
+			select {
+			case request := <-r.requests:
+				open = add(request)
+			case <-linger.C:
+				break lingerLoop
+			}
+		}
+		linger.Stop()
+		acquired := false
+	acquireLoop:
+		for open {
+			select {
+			case r.inflight <- chess.SENTINEL:
+				acquired = true
+				break acquireLoop
+			case request := <-r.requests:
+				open = add(request)
+			}
+		}
+		if !acquired {
+			r.inflight <- chess.SENTINEL
+		}
+		r.wg.Add(1)
+		go func(pending []remoteRequest) {
+			defer r.wg.Done()
+			defer func() { <-r.inflight }()
+			r.send(pending)
+		}(pending)
+	}
+}
+
+// send evaluates a batch with the remote service and replies to every request in it
+func (r *remoteHeuristic) send(pending []remoteRequest) {
+	// several workers often ask about the same features at once, so only send each once
+	body := remoteBatchRequest{Version: chess.FEATURE_VERSION}
+	indexes := make(map[chess.FeatureVector]int)
+	for _, request := range pending {
+		for _, features := range request.features {
+			if _, ok := indexes[features]; !ok {
+				indexes[features] = len(body.Features)
+				body.Features = append(body.Features, features)
+			}
+		}
+	}
+	values, err := r.post(body)
+	for _, request := range pending {
+		if err != nil {
+			request.reply <- remoteReply{err: err}
+			continue
+		}
+		reply := remoteReply{values: make([]float32, len(request.features))}
+		for i, features := range request.features {
+			reply.values[i] = values[indexes[features]]
+		}
+		request.reply <- reply
+	}
+}
+
+func (r *remoteHeuristic) post(body remoteBatchRequest) ([]float32, error) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode remote heuristic request: %w", err)
+	}
+	response, err := r.client.Post(r.url, "application/json", bytes.NewReader(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("failed to call remote heuristic: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("remote heuristic responded with status %s", response.Status)
+	}
+	var decoded remoteBatchResponse
+	err = json.NewDecoder(response.Body).Decode(&decoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode remote heuristic response: %w", err)
+	}
+	if len(decoded.Values) != len(body.Features) {
+		return nil, fmt.Errorf("remote heuristic returned %d values for %d boards", len(decoded.Values), len(body.Features))
+	}
+	return decoded.Values, nil
+}
+
+// close stops batching and waits for any batches in flight to be answered
+func (r *remoteHeuristic) close() error {
+	close(r.done)
+	r.wg.Wait()
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/AlexTGMM/chess-coverage-search/chess"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRemoteHeuristic(t *testing.T) {
+	defer func(previous int) { *remoteBatchSize = previous }(*remoteBatchSize)
+	*remoteBatchSize = 4
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var request remoteBatchRequest
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil || request.Version != chess.FEATURE_VERSION || len(request.Features) > *remoteBatchSize {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		response := remoteBatchResponse{}
+		for _, features := range request.Features {
+			response.Values = append(response.Values, features[chess.FEATURE_COVERAGE])
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	remote, cleanup, err := parseHeuristic(server.URL)
+	if err != nil {
+		t.Fatalf("failed to create remote heuristic: %v", err)
+	}
+	defer func() { _ = cleanup() }()
+	defer func(previous heuristicFunc) { heuristic = previous }(heuristic)
+	heuristic = remote
+
+	// a single worker expanding a single board, so only batching within the expansion can save round trips
+	result := jobResult{}
+	err = expand(&result, chess.MinimalBoard{}, INITIAL_BEST_SCORE)
+	if err != nil {
+		t.Fatalf("failed to expand the root: %v", err)
+	}
+	batches := (len(result.boards) + *remoteBatchSize - 1) / *remoteBatchSize
+	if calls.Load() == 0 || int(calls.Load()) > batches {
+		t.Errorf("expected the root's %d proposals to take at most %d calls, but they took %d",
+			len(result.boards), batches, calls.Load())
+	}
+	for _, board := range result.boards {
+		if board.Heuristic != float32(board.Coverage) {
+			t.Errorf("unexpected heuristic.  wanted %d but got %f", board.Coverage, board.Heuristic)
+		}
+	}
+
+	before := calls.Load()
+	err = expand(&jobResult{}, chess.MinimalBoard{}, INITIAL_BEST_SCORE)
+	if err != nil {
+		t.Fatalf("failed to expand the root again: %v", err)
+	}
+	if calls.Load() != before {
+		t.Errorf("expected cached evaluations, but made %d more calls", calls.Load()-before)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"github.com/AlexTGMM/chess-coverage-search/chess"
+	"sort"
+	"strings"
+)
+
+// heuristicFunc ranks boards for the edge set, returning a value for each board in the same order.  Higher is
+// better.  Every proposal of an expansion is ranked in a single call
+type heuristicFunc func(boards []*chess.Board) ([]float32, error)
+
+// eachBoard makes a heuristicFunc out of a heuristic that ranks a single board at a time
+func eachBoard(rank func(board *chess.Board) (float32, error)) heuristicFunc {
+	return func(boards []*chess.Board) ([]float32, error) {
+		values := make([]float32, len(boards))
+		for i, board := range boards {
+			value, err := rank(board)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	}
+}
+
+// single ranks a single board, for drawing
+func (h heuristicFunc) single(board *chess.Board) (float32, error) {
+	values, err := h([]*chess.Board{board})
+	if err != nil {
+		return 0, err
+	}
+	return values[0], nil
+}
+
+// heuristicBackend builds a heuristic from the argument following the colon in -heuristic.  The returned
+// cleanup function is called once the search is finished, and may be nil
+type heuristicBackend func(arg string) (heuristicFunc, func() error, error)
+
+// heuristicBackends every heuristic selectable with -heuristic, keyed by the name before the colon.  Optional
+// backends register themselves here from their own files
+var heuristicBackends = map[string]heuristicBackend{
+	"default": func(string) (heuristicFunc, func() error, error) {
+		return eachBoard(defaultHeuristic), nil, nil
+	},
+}
+
+// parseHeuristic resolves a -heuristic value of the form name[:arg] into a heuristic
+func parseHeuristic(spec string) (heuristicFunc, func() error, error) {
+	name, arg, _ := strings.Cut(spec, ":")
+	backend, ok := heuristicBackends[name]
+	if !ok {
+		names := make([]string, 0, len(heuristicBackends))
+		for name := range heuristicBackends {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, nil, fmt.Errorf("unknown heuristic %q, expected one of %v", name, names)
+	}
+	return backend(arg)
+}
+
+// defaultHeuristic is a heuristic based on board coverage slightly biased towards piece efficiency
+// NB: it is not admissible, so this isn't true A*
+func defaultHeuristic(board *chess.Board) (float32, error) {
+	score, err := board.Score()
+	if err != nil {
+		return 0, fmt.Errorf("failed to calculate score during heuristic: %w", err)
+	}
+	coverage := float32(board.GetCoverageLevel())
+	return (coverage / float32(score)) + coverage, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/AlexTGMM/chess-coverage-search/chess"
+	"slices"
+)
+
+// command line flags to control how boards are chosen for expansion
+var strategy = flag.String("strategy", "best-first", "how boards are chosen for expansion, either best-first or plunge")
+
+// checkStrategy rejects unknown values of -strategy
+func checkStrategy() error {
+	switch *strategy {
+	case "best-first", "plunge":
+		return nil
+	default:
+		return fmt.Errorf("unknown strategy %q, expected best-first or plunge", *strategy)
+	}
+}
+
+// expand rebuilds a board and adds every proposal within bound to the result
+func expand(result *jobResult, minimalBoard chess.MinimalBoard, bound int) error {
+	board, err := minimalBoard.RebuildBoard()
+	if err != nil {
+		return fmt.Errorf("failed to rebuild board: %w", err)
+	}
+	proposedBoards, err := board.ProposeBoards(heuristic, bound)
+	if err != nil {
+		return fmt.Errorf("failed to propose new boards: %w", err)
+	}
+	// add any boards that don't have too high of a score back to the work queue
+	// this is only best effort, so when a new best score is found, some boards with too
+	// high of a score may slip through.  This isn't an issue; they will be caught
+	// later by the orchestrator
+	for proposedBoard := range proposedBoards {
+		if proposedBoard.Score <= bound {
+			result.boards = append(result.boards, proposedBoard)
+		}
+	}
+	return nil
+}
+
+// plunge dives depth first from a board that was just expanded.  Best first search spends a long time widening
+// the frontier before it reaches any complete cover, and until it does, the bound can't prune anything.  So the
+// child with the most coverage is expanded straight away, then its best child, and so on for as long as coverage
+// keeps improving.  Every other child along the way is still returned to the frontier, so nothing is lost, and
+// best first selection picks up again from wherever the dive stopped
+func (g *group) plunge(result *jobResult, from chess.MinimalBoard, bound int) error {
+	children := 0
+	for current := from; ; {
+		next, ok := plungeTarget(result.boards[children:], current.Coverage)
+		if !ok {
+			return nil
+		}
+		// the dive has already expanded this board, so it mustn't go back into the frontier
+		index := children + slices.Index(result.boards[children:], next)
+		result.boards = slices.Delete(result.boards, index, index+1)
+		result.expanded = append(result.expanded, next)
+		g.processed.Add(1)
+		children = len(result.boards)
+		result.splits = append(result.splits, children)
+		err := expand(result, next, bound)
+		if err != nil {
+			return err
+		}
+		current = next
+	}
+}
+
+// plungeTarget picks the child with the most coverage, if it improves on coverage.  There's no point diving any
+// further once a child is solved, since the bound is about to drop.  Ties are broken by heuristic and then by
+// pieces, so deterministic runs dive the same way every time
+func plungeTarget(children []chess.MinimalBoard, coverage int) (chess.MinimalBoard, bool) {
+	var best chess.MinimalBoard
+	found := false
+	for _, child := range children {
+		if child.IsSolved {
+			return chess.MinimalBoard{}, false
+		}
+		if child.Coverage <= coverage {
+			continue
+		}
+		if !found || child.Coverage > best.Coverage ||
+			(child.Coverage == best.Coverage && (child.Heuristic > best.Heuristic ||
+				(child.Heuristic == best.Heuristic && child.Less(best)))) {
+			best = child
+			found = true
+		}
+	}
+	return best, found
+}
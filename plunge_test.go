@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/AlexTGMM/chess-coverage-search/chess"
+	"testing"
+)
+
+func TestPlungeTarget(t *testing.T) {
+	children := []chess.MinimalBoard{makeTestBoard(10, 5), makeTestBoard(30, 20), makeTestBoard(30, 10)}
+	// coverage wins first, then heuristic
+	best, ok := plungeTarget(children, 10)
+	if !ok || best != children[2] {
+		t.Errorf("expected %v, got %v", children[2], best)
+	}
+	// nothing improves on coverage, so the dive is over
+	_, ok = plungeTarget(children, 30)
+	if ok {
+		t.Errorf("expected no target when coverage doesn't improve")
+	}
+	solved := makeTestBoard(chess.BOARD_SIZE*chess.BOARD_SIZE, 40)
+	solved.IsSolved = true
+	_, ok = plungeTarget(append(children, solved), 10)
+	if ok {
+		t.Errorf("expected no target once a child is solved")
+	}
+}
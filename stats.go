@@ -0,0 +1,70 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// solverRunning whether a Solver is running.  A new Solver resets the package level state, which would
+// corrupt a run that's still going
+var solverRunning atomic.Bool
+
+// Solver a single run of the search, created by NewSolver.  Each group keeps its own counters, and Stats sums
+// them, so anything watching a run holds on to its Solver rather than reading package level state.  The search
+// itself is still configured by the command line flags, and shares the bound, the best solution, the heuristic
+// and the trace with the rest of the package, so only one Solver can run at a time
+type Solver struct {
+	groups  []*group
+	started time.Time
+}
+
+// RunStats a snapshot of the progress of a run.  Every field is a plain value, so a snapshot can be kept,
+// compared, or serialized without holding on to the run
+type RunStats struct {
+	// boards handed to the workers
+	Processed int64
+	// boards proposed that had already been seen
+	Duplicates int64
+	// unique boards seen, across all groups
+	Seen int64
+	// boards waiting in the edge sets
+	Frontier int64
+	// boards waiting in the work queues, and results waiting to be merged
+	Queued    int64
+	Prospects int64
+	// jobs the workers are currently handling
+	Outstanding int64
+	// boards forgotten to stay within -max-frontier
+	Evicted int64
+	// the best solution score so far, or the initial bound if nothing has been solved yet
+	BestScore int32
+	// time since the Solver was created
+	Uptime time.Duration
+	// averaged over the whole run
+	ProcessedPerSecond  float64
+	DuplicatesPerSecond float64
+}
+
+// Stats takes a snapshot of the run, and is safe to call from any goroutine while the run is going.  The
+// counters are read one at a time while the run carries on, so they may be slightly out of step with each other
+func (s *Solver) Stats() RunStats {
+	result := RunStats{
+		BestScore: currBestScore.Load(),
+		Uptime:    time.Since(s.started),
+	}
+	for _, g := range s.groups {
+		result.Processed += g.processed.Load()
+		result.Duplicates += g.duplicates.Load()
+		result.Evicted += g.evicted.Load()
+		result.Seen += g.seenCount.Load()
+		result.Frontier += g.edgeSetCount.Load()
+		result.Queued += int64(len(g.workQueue))
+		result.Prospects += int64(len(g.resultQueue))
+		result.Outstanding += int64(g.outstandingJobs.Load())
+	}
+	if seconds := result.Uptime.Seconds(); seconds > 0 {
+		result.ProcessedPerSecond = float64(result.Processed) / seconds
+		result.DuplicatesPerSecond = float64(result.Duplicates) / seconds
+	}
+	return result
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"github.com/AlexTGMM/chess-coverage-search/chess"
+	"testing"
+	"time"
+)
+
+func TestSolver_Stats(t *testing.T) {
+	currBestScore.Store(INITIAL_BEST_SCORE)
+	// the seen sets tell boards apart by their pieces, so the roots have to be real boards
+	roots := proposeSorted(t, chess.MinimalBoard{})[:2]
+	groups := make([]*group, 2)
+	for i := range groups {
+		var err error
+		groups[i], err = newGroup(i, 1, roots)
+		if err != nil {
+			t.Fatalf("failed to create group: %v", err)
+		}
+	}
+	groups[0].processed.Store(6)
+	groups[1].processed.Store(4)
+	// the second group already has a duplicate waiting to be merged
+	groups[1].insertBoard(roots[0])
+	groups[1].resultQueue <- jobResult{}
+	groups[1].outstandingJobs.Add(1)
+	solver := &Solver{groups: groups, started: time.Now().Add(-2 * time.Second)}
+	stats := solver.Stats()
+	expected := RunStats{Processed: 10, Duplicates: 1, Seen: 4, Frontier: 4, Prospects: 1, Outstanding: 1,
+		BestScore: INITIAL_BEST_SCORE}
+	if stats.Uptime < 2*time.Second {
+		t.Errorf("expected at least 2s of uptime, got %v", stats.Uptime)
+	}
+	if stats.ProcessedPerSecond <= 0 || stats.ProcessedPerSecond > 5 {
+		t.Errorf("expected at most 5 boards per second, got %f", stats.ProcessedPerSecond)
+	}
+	stats.Uptime, stats.ProcessedPerSecond, stats.DuplicatesPerSecond = 0, 0, 0
+	if stats != expected {
+		t.Errorf("unexpected stats.  wanted %+v but got %+v", expected, stats)
+	}
+}
+
+func TestNewSolver(t *testing.T) {
+	solver, err := NewSolver(2)
+	if err != nil {
+		t.Fatalf("failed to create solver: %v", err)
+	}
+	stats := solver.Stats()
+	if stats.Frontier != 1 || stats.Seen != 1 || stats.Processed != 0 || stats.BestScore != INITIAL_BEST_SCORE {
+		t.Errorf("expected a fresh solver holding only the empty board, got %+v", stats)
+	}
+}
+
+func TestNewSolver_running(t *testing.T) {
+	defer solverRunning.Store(false)
+	solver, err := NewSolver(2)
+	if err != nil {
+		t.Fatalf("failed to create solver: %v", err)
+	}
+	// a run in progress owns the bound, so neither a new solver nor a second run can start
+	solverRunning.Store(true)
+	currBestScore.Store(20)
+	_, err = NewSolver(2)
+	if err == nil {
+		t.Errorf("expected an error creating a solver while another is running")
+	}
+	if currBestScore.Load() != 20 {
+		t.Errorf("expected the running solver's bound to be left alone, got %d", currBestScore.Load())
+	}
+	err = solver.Run(context.Background())
+	if err == nil {
+		t.Errorf("expected an error running a solver while another is running")
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/AlexTGMM/chess-coverage-search/chess"
+	"io"
+	"os"
+	"strings"
+)
+
+// command line flags to control tracing
+var traceFile = flag.String("trace", "", "record a trace of a -deterministic run to `file`, to be checked later with the replay subcommand")
+
+// untracedFlags flags that don't change the course of the search, so they aren't recorded in traces
+var untracedFlags = map[string]bool{
+	"cpuprofile":   true,
+	"display":      true,
+	"memprofile":   true,
+	"max-duration": true,
+	"trace":        true,
+}
+
+// traceHeader the first line of a trace, recording everything needed to repeat the run
+type traceHeader struct {
+	BoardSize int               `json:"board_size"`
+	Cores     int               `json:"cores"`
+	Bound     int32             `json:"bound"`
+	Flags     map[string]string `json:"flags"`
+}
+
+// traceEvent every line of a trace after the header.  Rounds record the state of one group after one
+// deterministic round, solutions record each solution in the order it was drawn, and the end of the run
+// records whether the run was cut short
+type traceEvent struct {
+	Type  string `json:"type"`
+	Round int    `json:"round"`
+	Group int    `json:"group"`
+	// round events
+	Bound      int32  `json:"bound,omitempty"`
+	Jobs       int    `json:"jobs,omitempty"`
+	Inserted   int    `json:"inserted,omitempty"`
+	Duplicates int    `json:"duplicates,omitempty"`
+	Dedup      string `json:"dedup,omitempty"`
+	Evicted    int    `json:"evicted,omitempty"`
+	// solution events
+	Score int    `json:"score,omitempty"`
+	Board string `json:"board,omitempty"`
+	// end events
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// errTraceEnded is returned while replaying once the replay has caught up with a trace that was cut short
+var errTraceEnded = errors.New("trace ended")
+
+// tracer receives the events of a deterministic run, either to record them, or to check them against a
+// recording
+type tracer interface {
+	record(event traceEvent) error
+	close() error
+}
+
+// trace the tracer for this run, or nil if the run isn't being traced
+var trace tracer
+
+// traceWriter records a trace to a file
+type traceWriter struct {
+	file    *os.File
+	buffer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+func newTraceWriter(path string, cores int, bound int32) (*traceWriter, error) {
+	if !*deterministic {
+		return nil, fmt.Errorf("-trace requires -deterministic")
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace file: %w", err)
+	}
+	result := &traceWriter{file: file, buffer: bufio.NewWriter(file)}
+	result.encoder = json.NewEncoder(result.buffer)
+	header := traceHeader{BoardSize: chess.BOARD_SIZE, Cores: cores, Bound: bound, Flags: map[string]string{}}
+	// record every flag, not just the ones that were set, in case the defaults change.  The flags the testing
+	// package registers have nothing to do with the search
+	flag.VisitAll(func(f *flag.Flag) {
+		if !untracedFlags[f.Name] && !strings.HasPrefix(f.Name, "test.") {
+			header.Flags[f.Name] = f.Value.String()
+		}
+	})
+	err = result.encoder.Encode(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write trace header: %w", err)
+	}
+	return result, nil
+}
+
+func (t *traceWriter) record(event traceEvent) error {
+	err := t.encoder.Encode(event)
+	if err != nil {
+		return fmt.Errorf("failed to write trace event: %w", err)
+	}
+	// flush every round, so a run that is killed still leaves a trace that can be checked up to that round
+	if event.Type == "round" {
+		err = t.buffer.Flush()
+		if err != nil {
+			return fmt.Errorf("failed to flush trace: %w", err)
+		}
+	}
+	return nil
+}
+
+func (t *traceWriter) close() error {
+	err := t.buffer.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to flush trace: %w", err)
+	}
+	return t.file.Close()
+}
+
+// traceChecker compares the events of a replay against a recorded trace, and fails on the first difference
+type traceChecker struct {
+	file    *os.File
+	decoder *json.Decoder
+	header  traceHeader
+	// how many events have matched so far
+	matched int
+}
+
+// openTrace opens a recorded trace and reads its header
+func openTrace(path string) (*traceChecker, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file: %w", err)
+	}
+	result := &traceChecker{file: file, decoder: json.NewDecoder(bufio.NewReader(file))}
+	err = result.decoder.Decode(&result.header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trace header: %w", err)
+	}
+	if result.header.BoardSize != chess.BOARD_SIZE {
+		return nil, fmt.Errorf("trace was recorded with board size %d, but this build uses %d",
+			result.header.BoardSize, chess.BOARD_SIZE)
+	}
+	if result.header.Bound != INITIAL_BEST_SCORE {
+		return nil, fmt.Errorf("trace was recorded with an initial bound of %d, but this build uses %d",
+			result.header.Bound, INITIAL_BEST_SCORE)
+	}
+	return result, nil
+}
+
+func (t *traceChecker) record(event traceEvent) error {
+	var expected traceEvent
+	err := t.decoder.Decode(&expected)
+	// a trace without an end event was interrupted, so there's nothing left to compare against.  If it was
+	// killed part way through writing an event, the last line is cut off too
+	if err == io.EOF || err == io.ErrUnexpectedEOF || (expected.Type == "end" && expected.Truncated) {
+		return errTraceEnded
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read trace event: %w", err)
+	}
+	if event != expected {
+		return fmt.Errorf("nondeterminism detected after %d matching events:\n\texpected %+v\n\tbut got  %+v",
+			t.matched, expected, event)
+	}
+	t.matched++
+	return nil
+}
+
+func (t *traceChecker) close() error {
+	return t.file.Close()
+}
+
+// traceHash accumulates the dedup decisions of a round, so they can be compared without recording every board
+type traceHash uint64
+
+func newTraceHash() traceHash {
+	return 14695981039346656037
+}
+
+// add mixes a board and whether it was inserted into the hash with FNV-1a
+func (h traceHash) add(board chess.MinimalBoard, inserted bool) traceHash {
+	const prime = 1099511628211
+	for _, piece := range board.Key() {
+		h = (h ^ traceHash(piece)) * prime
+	}
+	if inserted {
+		h = (h ^ 1) * prime
+	}
+	return h * prime
+}
+
+func (h traceHash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// traceBoard a compact, single line rendering of a board's pieces
+func traceBoard(board chess.MinimalBoard) string {
+	result := strings.Builder{}
+	for _, piece := range board.Key() {
+		result.WriteRune(piece.GetRune())
+	}
+	return result.String()
+}
+
+// replay repeats the run recorded in a trace in deterministic mode, and checks that every round and solution
+// matches the recording
+func replay(path string) error {
+	checker, err := openTrace(path)
+	if err != nil {
+		return err
+	}
+	for name, value := range checker.header.Flags {
+		err = flag.Set(name, value)
+		if err != nil {
+			return fmt.Errorf("failed to restore flag -%s=%s from trace: %w", name, value, err)
+		}
+	}
+	trace = checker
+	defer func() { _ = checker.close() }()
+	var cleanup func() error
+	heuristic, cleanup, err = parseHeuristic(*heuristicSpec)
+	if err != nil {
+		return err
+	}
+	if cleanup != nil {
+		defer func() { _ = cleanup() }()
+	}
+	renderOptions.Heuristic = heuristic.single
+	solver, err := NewSolver(checker.header.Cores)
+	if err != nil {
+		return err
+	}
+	err = solver.Run(context.Background())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("replay matched all %d events of %s\n", checker.matched, path)
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/AlexTGMM/chess-coverage-search/chess"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTraceChecker_truncated(t *testing.T) {
+	header, err := json.Marshal(traceHeader{BoardSize: chess.BOARD_SIZE, Bound: INITIAL_BEST_SCORE})
+	if err != nil {
+		t.Fatalf("failed to encode header: %v", err)
+	}
+	event := traceEvent{Type: "round", Group: 1, Bound: INITIAL_BEST_SCORE, Jobs: 3}
+	line, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("failed to encode event: %v", err)
+	}
+	// a run killed part way through writing its second event
+	contents := string(header) + "\n" + string(line) + "\n" + string(line[:len(line)/2])
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	err = os.WriteFile(path, []byte(contents), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write trace: %v", err)
+	}
+	checker, err := openTrace(path)
+	if err != nil {
+		t.Fatalf("failed to open trace: %v", err)
+	}
+	defer func() { _ = checker.close() }()
+	err = checker.record(event)
+	if err != nil {
+		t.Fatalf("expected the first event to match: %v", err)
+	}
+	err = checker.record(event)
+	if !errors.Is(err, errTraceEnded) {
+		t.Errorf("expected a cut off event to end the trace, got %v", err)
+	}
+}
+
+// a recorded run replays cleanly, and a replay that doesn't match the recording is caught
+func TestReplay(t *testing.T) {
+	setDeterministic(t)
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	writer, err := newTraceWriter(path, 3, INITIAL_BEST_SCORE)
+	if err != nil {
+		t.Fatalf("failed to create trace: %v", err)
+	}
+	events := runTraced(t, writer, INITIAL_BEST_SCORE, 8)
+	err = writer.close()
+	if err != nil {
+		t.Fatalf("failed to close trace: %v", err)
+	}
+	err = replay(path)
+	if err != nil {
+		t.Fatalf("expected the replay to match the recording: %v", err)
+	}
+
+	// tamper with the dedup decisions of the first round that had any
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read trace: %v", err)
+	}
+	lines := strings.Split(string(contents), "\n")
+	changed := -1
+	for i, event := range events {
+		if event.Type == "round" && event.Dedup != "" {
+			changed = i
+			break
+		}
+	}
+	if changed < 0 {
+		t.Fatalf("expected a round with dedup decisions in %d events", len(events))
+	}
+	event := events[changed]
+	event.Dedup = (^traceHash(0)).String()
+	if event.Dedup == events[changed].Dedup {
+		event.Dedup = newTraceHash().String()
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("failed to encode event: %v", err)
+	}
+	// the header is the first line
+	lines[changed+1] = string(line)
+	err = os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write trace: %v", err)
+	}
+	err = replay(path)
+	if err == nil || !strings.Contains(err.Error(), "nondeterminism detected") {
+		t.Errorf("expected the replay to detect the changed round, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime/pprof"
+	"time"
+)
+
+// command line flags to control the watchdog
+var watchdogPeriod = flag.Duration("watchdog", 5*time.Minute, "abort the run if no boards are processed for this long while work is pending, 0 to disable")
+
+// makeWatchdog watches for a pipeline that has stopped making progress.  If no board has been handed to a
+// worker for a whole period, even though there are boards waiting or jobs outstanding, something is wedged.
+// Rather than leave the run silently hanging, the watchdog dumps the state of every group and the stacks of
+// every goroutine, then fails, which shuts the rest of the run down through the shared context
+func makeWatchdog(ctx context.Context, groups []*group, finished chan struct{}) func() error {
+	return func() error {
+		ticker := time.NewTicker(*watchdogPeriod)
+		defer ticker.Stop()
+		lastProcessed := processedCount(groups)
+		for {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("context expired on watchdog: %w", ctx.Err())
+			case <-finished:
+				return nil
+			case <-ticker.C:
+				currProcessed := processedCount(groups)
+				if currProcessed != lastProcessed || !workPending(groups) {
+					lastProcessed = currProcessed
+					continue
+				}
+				log.Printf("watchdog: no boards processed in %v, dumping pipeline state", *watchdogPeriod)
+				for _, g := range groups {
+					log.Printf("group %d\tworkers: %d\tseen: %d\tcurrent: %d\tqueued: %d\tprospects: %d\toutstanding: %d",
+						g.id, g.workers, g.seenCount.Load(), g.edgeSetCount.Load(),
+						len(g.workQueue), len(g.resultQueue), g.outstandingJobs.Load())
+				}
+				err := pprof.Lookup("goroutine").WriteTo(os.Stderr, 2)
+				if err != nil {
+					log.Printf("watchdog: failed to dump goroutines: %v", err)
+				}
+				return fmt.Errorf("watchdog: pipeline stalled at %d processed boards", currProcessed)
+			}
+		}
+	}
+}
+
+// processedCount sums how many boards every group has handled
+func processedCount(groups []*group) (result int64) {
+	for _, g := range groups {
+		result += g.processed.Load()
+	}
+	return result
+}
+
+// workPending reports if any group still has boards to search, or jobs in flight
+func workPending(groups []*group) bool {
+	for _, g := range groups {
+		if g.edgeSetCount.Load() > 0 || len(g.workQueue) > 0 || len(g.resultQueue) > 0 || g.outstandingJobs.Load() > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMakeWatchdog(t *testing.T) {
+	defer func(previous time.Duration) { *watchdogPeriod = previous }(*watchdogPeriod)
+	*watchdogPeriod = 10 * time.Millisecond
+
+	// boards are waiting, but none are ever processed
+	stalled := &group{}
+	stalled.edgeSetCount.Store(1)
+	stalled.processed.Store(5)
+	err := makeWatchdog(context.Background(), []*group{stalled}, make(chan struct{}))()
+	if err == nil || !strings.Contains(err.Error(), "pipeline stalled at 5 processed boards") {
+		t.Errorf("expected the watchdog to report the stall, got %v", err)
+	}
+
+	// a run that finishes stops the watchdog cleanly, stalled or not
+	finished := make(chan struct{})
+	close(finished)
+	err = makeWatchdog(context.Background(), []*group{stalled}, finished)()
+	if err != nil {
+		t.Errorf("expected the watchdog to stop when the run finished, got %v", err)
+	}
+
+	// an idle pipeline with nothing pending isn't stalled
+	ctx, cancel := context.WithTimeout(context.Background(), 5*(*watchdogPeriod))
+	defer cancel()
+	err = makeWatchdog(ctx, []*group{{}}, make(chan struct{}))()
+	if err == nil || !strings.Contains(err.Error(), "context expired") {
+		t.Errorf("expected the watchdog to wait out an idle pipeline, got %v", err)
+	}
+}